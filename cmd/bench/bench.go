@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package bench
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/output"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// The number of pings used to measure latency.
+const latencySamples = 5
+
+// Result is the result of a benchmark run.
+type Result struct {
+	Host string `json:"host"`
+	// Bytes is the number of bytes received by the server.
+	Bytes int64 `json:"bytes"`
+	// Duration is how long data was sent for.
+	Duration string `json:"duration"`
+	// BitsPerSecond is the measured TCP throughput.
+	BitsPerSecond float64 `json:"bitsPerSecond"`
+	// The round trip times of ICMP echo requests to the host.
+	LatencyMin string `json:"latencyMin,omitempty"`
+	LatencyAvg string `json:"latencyAvg,omitempty"`
+	LatencyMax string `json:"latencyMax,omitempty"`
+}
+
+// Serve opens the WireGuard network and serves benchmark requests on the given
+// port until interrupted.
+func Serve(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, port int) error {
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.Bench(logger, port),
+	})
+}
+
+// Run opens the WireGuard network and measures the latency and TCP throughput
+// to the benchmark server running on the given host.
+func Run(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	host string, port int, duration time.Duration, format string) error {
+	if err := output.Validate(format); err != nil {
+		return err
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		&runService{
+			logger:   logger,
+			host:     host,
+			port:     port,
+			duration: duration,
+			format:   format,
+			w:        os.Stdout,
+		},
+	})
+}
+
+var _ service.Service = (*runService)(nil)
+
+type runService struct {
+	logger   *slog.Logger
+	host     string
+	port     int
+	duration time.Duration
+	format   string
+	w        io.Writer
+}
+
+func (s *runService) Serve(ctx context.Context, net network.Network) error {
+	result := Result{Host: s.host}
+
+	s.logger.Info("Measuring latency", slog.String("host", s.host))
+
+	if err := s.measureLatency(ctx, net, &result); err != nil {
+		// Not fatal, ICMP may be filtered.
+		s.logger.Warn("Failed to measure latency", slog.Any("error", err))
+	}
+
+	s.logger.Info("Measuring throughput", slog.String("host", s.host), slog.Duration("duration", s.duration))
+
+	if err := s.measureThroughput(ctx, net, &result); err != nil {
+		return err
+	}
+
+	if !output.IsHuman(s.format) {
+		return output.Write(s.w, s.format, result)
+	}
+
+	fmt.Fprintf(s.w, "Host:       %s\n", result.Host)
+	if result.LatencyAvg != "" {
+		fmt.Fprintf(s.w, "Latency:    min/avg/max = %s/%s/%s\n", result.LatencyMin, result.LatencyAvg, result.LatencyMax)
+	}
+	fmt.Fprintf(s.w, "Transfer:   %.2f MB in %s\n", float64(result.Bytes)/1e6, result.Duration)
+	fmt.Fprintf(s.w, "Throughput: %.2f Mbit/s\n", result.BitsPerSecond/1e6)
+	return nil
+}
+
+func (s *runService) measureLatency(ctx context.Context, net network.Network, result *Result) error {
+	// The first ping may have to wait for a handshake to complete.
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := net.Ping(pingCtx, "ip", s.host); err != nil {
+		return err
+	}
+
+	var minRTT, maxRTT, totalRTT time.Duration
+	for i := 0; i < latencySamples; i++ {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		start := time.Now()
+		err := net.Ping(pingCtx, "ip", s.host)
+		rtt := time.Since(start)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		totalRTT += rtt
+		if i == 0 || rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+	}
+
+	result.LatencyMin = minRTT.Round(time.Microsecond).String()
+	result.LatencyAvg = (totalRTT / latencySamples).Round(time.Microsecond).String()
+	result.LatencyMax = maxRTT.Round(time.Microsecond).String()
+
+	return nil
+}
+
+func (s *runService) measureThroughput(ctx context.Context, net network.Network, result *Result) error {
+	addr := stdnet.JoinHostPort(s.host, strconv.Itoa(s.port))
+
+	conn, err := net.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to benchmark server %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, 64*1024)
+
+	start := time.Now()
+	for time.Since(start) < s.duration {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := conn.SetWriteDeadline(start.Add(s.duration)); err != nil {
+			return err
+		}
+
+		if _, err := conn.Write(buf); err != nil {
+			var netErr stdnet.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+
+			return fmt.Errorf("failed to send data: %w", err)
+		}
+	}
+
+	if err := conn.SetWriteDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil {
+			return fmt.Errorf("failed to close connection: %w", err)
+		}
+	}
+
+	// Wait for the server to receive everything we sent.
+	var n uint64
+	if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+		return fmt.Errorf("failed to read result: %w", err)
+	}
+
+	elapsed := time.Since(start)
+
+	result.Bytes = int64(n)
+	result.Duration = elapsed.Round(time.Millisecond).String()
+	result.BitsPerSecond = float64(n) * 8 / elapsed.Seconds()
+
+	return nil
+}
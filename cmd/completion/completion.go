@@ -0,0 +1,180 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package completion
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/noisysockets/noisysockets/config"
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/urfave/cli/v2"
+)
+
+//go:embed scripts
+var scripts embed.FS
+
+// Shells is the list of shells completion scripts can be generated for.
+var Shells = []string{"bash", "zsh", "fish", "powershell"}
+
+var scriptNames = map[string]string{
+	"bash":       "nsh.bash",
+	"zsh":        "nsh.zsh",
+	"fish":       "nsh.fish",
+	"powershell": "nsh.ps1",
+}
+
+// Script writes the completion script for the given shell.
+func Script(w io.Writer, shell string) error {
+	name, ok := scriptNames[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q, expected one of: %s", shell, strings.Join(Shells, ", "))
+	}
+
+	script, err := scripts.ReadFile("scripts/" + name)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(script)
+	return err
+}
+
+// Peer is a peer in the config file, as reported in the metadata.
+type Peer struct {
+	Name      string   `json:"name,omitempty"`
+	PublicKey string   `json:"publicKey"`
+	IPs       []string `json:"ips,omitempty"`
+}
+
+// Flag describes a command line flag.
+type Flag struct {
+	Names []string `json:"names"`
+	Usage string   `json:"usage,omitempty"`
+}
+
+// Command describes a command and its subcommands.
+type Command struct {
+	Name        string    `json:"name"`
+	Aliases     []string  `json:"aliases,omitempty"`
+	Usage       string    `json:"usage,omitempty"`
+	ArgsUsage   string    `json:"argsUsage,omitempty"`
+	Flags       []Flag    `json:"flags,omitempty"`
+	Subcommands []Command `json:"subcommands,omitempty"`
+}
+
+// Metadata describes the available commands and configured peers, for use by
+// wrappers and other tools.
+type Metadata struct {
+	Commands []Command `json:"commands"`
+	Peers    []Peer    `json:"peers"`
+}
+
+// WriteMetadata writes the metadata for the app's commands, and the peers in
+// the config file at configPath, as JSON.
+func WriteMetadata(w io.Writer, app *cli.App, configPath string) error {
+	md := Metadata{
+		Commands: commands(app.Commands),
+		Peers:    Peers(configPath),
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(md)
+}
+
+// Peers returns the peers in the config file at configPath. Completion must
+// never prompt, so no peers are returned if the config is encrypted or can't
+// be read.
+func Peers(configPath string) []Peer {
+	data, err := os.ReadFile(configPath)
+	if err != nil || util.IsEncrypted(data) {
+		return []Peer{}
+	}
+
+	data, err = util.ExpandConfig(data, filepath.Dir(configPath))
+	if err != nil {
+		return []Peer{}
+	}
+
+	conf, err := config.FromYAML(bytes.NewReader(data))
+	if err != nil {
+		return []Peer{}
+	}
+
+	peers := make([]Peer, 0, len(conf.Peers))
+	for _, peerConf := range conf.Peers {
+		peers = append(peers, Peer{
+			Name:      peerConf.Name,
+			PublicKey: peerConf.PublicKey,
+			IPs:       peerConf.IPs,
+		})
+	}
+
+	return peers
+}
+
+// PeerNames returns a completion function that suggests the names of the
+// peers in the config file for the first argument of a command.
+func PeerNames(configPath func(c *cli.Context) string) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		// Flags are completed as usual.
+		if len(os.Args) > 2 && strings.HasPrefix(os.Args[len(os.Args)-2], "-") {
+			cli.DefaultCompleteWithFlags(c.Command)(c)
+			return
+		}
+
+		if c.NArg() > 0 {
+			return
+		}
+
+		for _, peer := range Peers(configPath(c)) {
+			if peer.Name != "" {
+				fmt.Fprintln(c.App.Writer, peer.Name)
+			}
+		}
+	}
+}
+
+func commands(cmds []*cli.Command) []Command {
+	var result []Command
+	for _, cmd := range cmds {
+		if cmd.Hidden {
+			continue
+		}
+
+		var flags []Flag
+		for _, f := range cmd.Flags {
+			var usage string
+			if df, ok := f.(cli.DocGenerationFlag); ok {
+				usage = df.GetUsage()
+			}
+
+			flags = append(flags, Flag{Names: f.Names(), Usage: usage})
+		}
+
+		result = append(result, Command{
+			Name:        cmd.Name,
+			Aliases:     cmd.Aliases,
+			Usage:       cmd.Usage,
+			ArgsUsage:   cmd.ArgsUsage,
+			Flags:       flags,
+			Subcommands: commands(cmd.Subcommands),
+		})
+	}
+
+	return result
+}
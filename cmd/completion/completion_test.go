@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package completion_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/completion"
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+const testConfig = `apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+name: a
+privateKey: 6M9S7lTdevlmWBftBbUx8lnXvVuyjG+PiCzpbx6vu3Q=
+ips:
+  - 10.7.0.1
+peers:
+  - name: b
+    publicKey: zzZQPVEk52JZhnxNP/iGQnImksI/XfSzdv901MPfPUY=
+    ips:
+      - 10.7.0.2
+`
+
+func TestScript(t *testing.T) {
+	for _, shell := range completion.Shells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, completion.Script(&buf, shell))
+			require.Contains(t, buf.String(), "--generate-bash-completion")
+		})
+	}
+
+	t.Run("Unsupported", func(t *testing.T) {
+		require.Error(t, completion.Script(&bytes.Buffer{}, "tcsh"))
+	})
+}
+
+func TestPeers(t *testing.T) {
+	dir := t.TempDir()
+
+	configPath := filepath.Join(dir, "noisysockets.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0o600))
+
+	peers := completion.Peers(configPath)
+	require.Len(t, peers, 1)
+	require.Equal(t, "b", peers[0].Name)
+	require.Equal(t, []string{"10.7.0.2"}, peers[0].IPs)
+
+	t.Run("Encrypted", func(t *testing.T) {
+		data, err := util.Encrypt([]byte(testConfig), "passphrase")
+		require.NoError(t, err)
+
+		encryptedPath := filepath.Join(dir, "encrypted.yaml")
+		require.NoError(t, os.WriteFile(encryptedPath, data, 0o600))
+
+		require.Empty(t, completion.Peers(encryptedPath))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		require.Empty(t, completion.Peers(filepath.Join(dir, "missing.yaml")))
+	})
+}
+
+func TestWriteMetadata(t *testing.T) {
+	dir := t.TempDir()
+
+	configPath := filepath.Join(dir, "noisysockets.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(testConfig), 0o600))
+
+	app := &cli.App{
+		Commands: []*cli.Command{
+			{
+				Name:      "ping",
+				Usage:     "Ping a host",
+				ArgsUsage: "host",
+				Flags: []cli.Flag{
+					&cli.IntFlag{Name: "count", Aliases: []string{"n"}, Usage: "Number of pings"},
+				},
+			},
+			{Name: "secret", Hidden: true},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, completion.WriteMetadata(&buf, app, configPath))
+
+	var md completion.Metadata
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &md))
+
+	require.Equal(t, []completion.Command{{
+		Name:      "ping",
+		Usage:     "Ping a host",
+		ArgsUsage: "host",
+		Flags:     []completion.Flag{{Names: []string{"count", "n"}, Usage: "Number of pings"}},
+	}}, md.Commands)
+	require.Len(t, md.Peers, 1)
+}
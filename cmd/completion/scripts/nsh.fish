@@ -0,0 +1,14 @@
+# fish completion for nsh, load it with: nsh completion fish | source
+
+function __nsh_complete
+    set -l args (commandline -opc)
+    set -l cur (commandline -ct)
+
+    if string match -q -- '-*' $cur
+        command $args $cur --generate-bash-completion 2>/dev/null
+    else
+        command $args --generate-bash-completion 2>/dev/null
+    end
+end
+
+complete -c nsh -f -a '(__nsh_complete)'
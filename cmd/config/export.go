@@ -13,14 +13,26 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"github.com/mdp/qrterminal/v3"
 	"github.com/noisysockets/noisysockets/config"
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"rsc.io/qr"
 )
 
-func Export(conf *latestconfig.Config, wireGuardConfigPath string, stripped bool) error {
+func Export(logger *slog.Logger, conf *latestconfig.Config, wireGuardConfigPath, format string, qrCode bool) error {
+	switch format {
+	case FormatWireGuard, FormatWGQuick:
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+
+	conf = routesViaPeerNames(logger, conf)
+
 	var w io.Writer
 	if wireGuardConfigPath == "-" {
 		w = os.Stdout
@@ -42,20 +54,62 @@ func Export(conf *latestconfig.Config, wireGuardConfigPath string, stripped bool
 		w = wireGuardConfigFile
 	}
 
-	if stripped {
-		var buf bytes.Buffer
-		if err := config.ToINI(&buf, conf); err != nil {
-			return fmt.Errorf("error writing WireGuard config: %w", err)
-		}
+	var buf bytes.Buffer
+	if err := config.ToINI(&buf, conf); err != nil {
+		return fmt.Errorf("error writing WireGuard config: %w", err)
+	}
+	wireGuardConfig := buf.Bytes()
 
-		if err := config.StripINI(w, bytes.NewReader(buf.Bytes())); err != nil {
+	if format == FormatWireGuard {
+		var strippedBuf bytes.Buffer
+		if err := config.StripINI(&strippedBuf, bytes.NewReader(wireGuardConfig)); err != nil {
 			return fmt.Errorf("error stripping WireGuard config: %w", err)
 		}
-	} else {
-		if err := config.ToINI(w, conf); err != nil {
-			return fmt.Errorf("error writing WireGuard config: %w", err)
+		wireGuardConfig = strippedBuf.Bytes()
+	}
+
+	if qrCode {
+		// Check the config will fit in a QR code (qrterminal ignores errors).
+		if _, err := qr.Encode(string(wireGuardConfig), qr.L); err != nil {
+			return fmt.Errorf("error encoding WireGuard config as QR code: %w", err)
 		}
+
+		qrterminal.GenerateHalfBlock(string(wireGuardConfig), qr.L, w)
+
+		return nil
+	}
+
+	if _, err := w.Write(wireGuardConfig); err != nil {
+		return fmt.Errorf("error writing WireGuard config: %w", err)
 	}
 
 	return nil
 }
+
+// routesViaPeerNames returns a copy of the config with routes that refer to
+// peers by public key, rewritten to use the peer's name. The INI writer only
+// matches routes by peer name when populating AllowedIPs.
+func routesViaPeerNames(logger *slog.Logger, conf *latestconfig.Config) *latestconfig.Config {
+	rewrittenConf := *conf
+	rewrittenConf.Routes = slices.Clone(conf.Routes)
+
+	for i, routeConf := range rewrittenConf.Routes {
+		for _, peerConf := range conf.Peers {
+			if routeConf.Via != peerConf.Name && routeConf.Via != peerConf.PublicKey {
+				continue
+			}
+
+			if peerConf.Name == "" {
+				logger.Warn("Route via unnamed peer will not be included in AllowedIPs",
+					slog.String("destination", routeConf.Destination),
+					slog.String("via", routeConf.Via))
+				break
+			}
+
+			rewrittenConf.Routes[i].Via = peerConf.Name
+			break
+		}
+	}
+
+	return &rewrittenConf
+}
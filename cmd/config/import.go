@@ -10,18 +10,46 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/netip"
 	"os"
 	"path/filepath"
+	"slices"
 
+	"github.com/miekg/dns"
 	"github.com/noisysockets/noisysockets/config"
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
 	"github.com/noisysockets/nsh/internal/util"
+	"gopkg.in/ini.v1"
 )
 
-func Import(logger *slog.Logger, configPath, wireGuardConfigPath string) error {
+// WireGuard configuration formats.
+const (
+	// FormatWireGuard is the format used by `wg setconf`.
+	FormatWireGuard = "wg"
+	// FormatWGQuick is the format used by `wg-quick`, a superset of the
+	// `wg setconf` format that includes interface addresses, DNS, etc.
+	FormatWGQuick = "wg-quick"
+)
+
+// Directives that can be imported, everything else will be ignored.
+var (
+	supportedInterfaceKeys = []string{"Address", "ListenPort", "MTU", "PrivateKey", "DNS"}
+	supportedPeerKeys      = []string{"PublicKey", "AllowedIPs", "Endpoint"}
+)
+
+func Import(logger *slog.Logger, configPath, wireGuardConfigPath, format string) error {
+	switch format {
+	case FormatWireGuard, FormatWGQuick:
+		// The wg format is a subset of the wg-quick format, so we can use the
+		// same parser for both.
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+
 	var r io.Reader
 	if wireGuardConfigPath == "-" {
 		r = os.Stdin
@@ -34,12 +62,52 @@ func Import(logger *slog.Logger, configPath, wireGuardConfigPath string) error {
 		r = wireGuardConfigFile
 	}
 
+	wireGuardConfig, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading WireGuard config: %w", err)
+	}
+
+	if err := warnUnsupportedDirectives(logger, wireGuardConfig); err != nil {
+		return fmt.Errorf("error parsing WireGuard config: %w", err)
+	}
+
 	return util.UpdateConfig(logger, configPath, func(_ *latestconfig.Config) (*latestconfig.Config, error) {
-		conf, err := config.FromINI(r)
+		conf, err := config.FromINI(bytes.NewReader(wireGuardConfig))
 		if err != nil {
 			return nil, fmt.Errorf("error parsing WireGuard config: %w", err)
 		}
 
+		// wg-quick interface addresses are usually in CIDR notation, but we
+		// only assign single addresses to the interface.
+		for i, ip := range conf.IPs {
+			if prefix, err := netip.ParsePrefix(ip); err == nil {
+				conf.IPs[i] = prefix.Addr().String()
+			}
+		}
+
+		// wg-quick allows search domains to be mixed in with the DNS servers.
+		if conf.DNS != nil {
+			var servers, searchDomains []string
+			for _, server := range conf.DNS.Servers {
+				if _, err := netip.ParseAddr(server); err == nil {
+					servers = append(servers, server)
+				} else {
+					searchDomains = append(searchDomains, server)
+				}
+			}
+
+			conf.DNS.Servers = servers
+
+			if len(searchDomains) > 0 {
+				conf.DNS.Domain = dns.Fqdn(searchDomains[0])
+
+				if len(searchDomains) > 1 {
+					logger.Warn("Only a single search domain is supported, ignoring the rest",
+						slog.String("domain", conf.DNS.Domain), slog.Any("ignored", searchDomains[1:]))
+				}
+			}
+		}
+
 		if err := os.MkdirAll(filepath.Dir(configPath), 0o700); err != nil {
 			return nil, fmt.Errorf("failed to create config directory: %w", err)
 		}
@@ -47,3 +115,34 @@ func Import(logger *slog.Logger, configPath, wireGuardConfigPath string) error {
 		return conf, nil
 	})
 }
+
+func warnUnsupportedDirectives(logger *slog.Logger, wireGuardConfig []byte) error {
+	iniConf, err := ini.LoadSources(ini.LoadOptions{AllowNonUniqueSections: true}, wireGuardConfig)
+	if err != nil {
+		return err
+	}
+
+	for _, section := range iniConf.Sections() {
+		var supportedKeys []string
+		switch section.Name() {
+		case ini.DefaultSection:
+			// Keys outside of any section.
+		case "Interface":
+			supportedKeys = supportedInterfaceKeys
+		case "Peer":
+			supportedKeys = supportedPeerKeys
+		default:
+			logger.Warn("Ignoring unsupported section", slog.String("section", section.Name()))
+			continue
+		}
+
+		for _, key := range section.Keys() {
+			if !slices.Contains(supportedKeys, key.Name()) {
+				logger.Warn("Ignoring unsupported directive",
+					slog.String("section", section.Name()), slog.String("directive", key.Name()))
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/noisysockets/config"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	configcmd "github.com/noisysockets/nsh/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	importConfig := func(t *testing.T, fixture string) (*latestconfig.Config, string) {
+		var logs strings.Builder
+		logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+		configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+
+		err := configcmd.Import(logger, configPath, filepath.Join("testdata", fixture), configcmd.FormatWGQuick)
+		require.NoError(t, err)
+
+		f, err := os.Open(configPath)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = f.Close()
+		})
+
+		conf, err := config.FromYAML(f)
+		require.NoError(t, err)
+
+		return conf, logs.String()
+	}
+
+	t.Run("CIDR Addresses", func(t *testing.T) {
+		conf, logs := importConfig(t, "wg-quick.conf")
+
+		// Only the interface addresses are kept, not the subnet.
+		require.Equal(t, []string{"10.0.0.2", "fd00::2"}, conf.IPs)
+		require.Equal(t, uint16(51820), conf.ListenPort)
+		require.Equal(t, 1380, conf.MTU)
+
+		require.Len(t, conf.Peers, 1)
+		require.Equal(t, "u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=", conf.Peers[0].PublicKey)
+		require.Equal(t, "192.0.2.1:51820", conf.Peers[0].Endpoint)
+		require.Equal(t, []string{"10.0.0.1", "fd00::1"}, conf.Peers[0].IPs)
+
+		require.Contains(t, logs, "directive=PostUp")
+		require.Contains(t, logs, "directive=PersistentKeepalive")
+	})
+
+	t.Run("Plain Addresses", func(t *testing.T) {
+		conf, _ := importConfig(t, "wg-quick-addresses.conf")
+
+		require.Equal(t, []string{"10.0.0.3"}, conf.IPs)
+	})
+
+	t.Run("Search Domains", func(t *testing.T) {
+		conf, logs := importConfig(t, "wg-quick.conf")
+
+		require.NotNil(t, conf.DNS)
+		require.Equal(t, []string{"10.0.0.1", "fd00::1"}, conf.DNS.Servers)
+		// The first search domain becomes the network domain.
+		require.Equal(t, "example.internal.", conf.DNS.Domain)
+
+		require.Contains(t, logs, "Only a single search domain is supported")
+		require.Contains(t, logs, "other.internal")
+	})
+
+	t.Run("No Search Domains", func(t *testing.T) {
+		conf, logs := importConfig(t, "wg-quick-addresses.conf")
+
+		require.NotNil(t, conf.DNS)
+		require.Equal(t, []string{"10.0.0.1"}, conf.DNS.Servers)
+		require.Empty(t, conf.DNS.Domain)
+
+		require.NotContains(t, logs, "search domain")
+	})
+}
@@ -10,9 +10,14 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/noisysockets/netutil/ula"
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
@@ -23,6 +28,186 @@ import (
 
 func Init(logger *slog.Logger, configPath string, hostname string,
 	listenPort int, ips []string, domain string) error {
+	hostname, listenPort, ips, err := initDefaults(logger, hostname, listenPort, ips)
+	if err != nil {
+		return err
+	}
+
+	if err := validate.IPs(ips); err != nil {
+		return fmt.Errorf("invalid IP address: %w", err)
+	}
+
+	_, err = initConfig(logger, configPath, hostname, listenPort, ips, domain, nil)
+	return err
+}
+
+// InitInteractive prompts the user for the configuration (using any provided
+// values as defaults), and optionally the details of any initial peers. Once
+// the configuration has been written, it prints the details that will need to
+// be shared with peers.
+func InitInteractive(logger *slog.Logger, configPath string, r io.Reader, w io.Writer,
+	hostname string, listenPort int, ips []string, domain string) error {
+	hostname, listenPort, ips, err := initDefaults(logger, hostname, listenPort, ips)
+	if err != nil {
+		return err
+	}
+
+	p := newPrompter(r, w)
+
+	// The configuration so far, so that each answer can be validated against
+	// the previous ones.
+	conf := &latestconfig.Config{}
+
+	hostname, err = p.String("Peer name", hostname, nil)
+	if err != nil {
+		return err
+	}
+	conf.Name = hostname
+
+	listenPortStr, err := p.String("WireGuard listen port", strconv.Itoa(listenPort), func(answer string) error {
+		port, err := strconv.Atoi(answer)
+		if err != nil {
+			return fmt.Errorf("invalid port %q: %w", answer, err)
+		}
+
+		return validate.Port(port)
+	})
+	if err != nil {
+		return err
+	}
+	listenPort, _ = strconv.Atoi(listenPortStr)
+
+	ips, err = p.List("IP address/s", ips, func(ips []string) error {
+		if err := requireIPs(ips); err != nil {
+			return err
+		}
+
+		candidate := *conf
+		candidate.IPs = ips
+		return validateField(&candidate, "ips")
+	})
+	if err != nil {
+		return err
+	}
+	conf.IPs = ips
+
+	domain, err = p.String("Network domain (optional)", domain, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		addPeer, err := p.Confirm("Add a peer?", false)
+		if err != nil {
+			return err
+		}
+
+		if !addPeer {
+			break
+		}
+
+		peerConf, err := promptPeer(p, conf)
+		if err != nil {
+			return err
+		}
+
+		conf.Peers = append(conf.Peers, *peerConf)
+	}
+
+	conf, err = initConfig(logger, configPath, hostname, listenPort, ips, domain, conf.Peers)
+	if err != nil {
+		return err
+	}
+
+	var privateKey types.NoisePrivateKey
+	if err := privateKey.UnmarshalText([]byte(conf.PrivateKey)); err != nil {
+		return fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	fmt.Fprintf(w, "\nConfiguration written to %s\n\n", configPath)
+	fmt.Fprintf(w, "Share the following details with your peers:\n\n")
+	fmt.Fprintf(w, "  Name:        %s\n", conf.Name)
+	fmt.Fprintf(w, "  Public key:  %s\n", privateKey.Public().String())
+	fmt.Fprintf(w, "  IPs:         %s\n", strings.Join(conf.IPs, ","))
+	fmt.Fprintf(w, "  Listen port: %d\n\n", conf.ListenPort)
+	fmt.Fprintf(w, "They can add this peer to their configuration with:\n\n")
+	fmt.Fprintf(w, "  nsh peer add --name=%s --public-key=%s --ip=%s --endpoint=<PUBLIC ADDRESS>:%d\n",
+		conf.Name, privateKey.Public().String(), strings.Join(conf.IPs, " --ip="), conf.ListenPort)
+
+	return nil
+}
+
+// promptPeer asks the user for the details of a new peer, validating each
+// answer against the configuration so far.
+func promptPeer(p *prompter, conf *latestconfig.Config) (*latestconfig.PeerConfig, error) {
+	var peerConf latestconfig.PeerConfig
+
+	// validatePeer validates a field of the new peer, as if it had already
+	// been added to the configuration.
+	validatePeer := func(newPeerConf latestconfig.PeerConfig, field string) error {
+		candidate := *conf
+		candidate.Peers = append(slices.Clip(conf.Peers), newPeerConf)
+
+		return validateField(&candidate, "peers", len(conf.Peers), field)
+	}
+
+	name, err := p.String("  Peer name", "", func(answer string) error {
+		newPeerConf := peerConf
+		newPeerConf.Name = answer
+		return validatePeer(newPeerConf, "name")
+	})
+	if err != nil {
+		return nil, err
+	}
+	peerConf.Name = name
+
+	publicKey, err := p.String("  Public key", "", func(answer string) error {
+		newPeerConf := peerConf
+		newPeerConf.PublicKey = answer
+		return validatePeer(newPeerConf, "publicKey")
+	})
+	if err != nil {
+		return nil, err
+	}
+	peerConf.PublicKey = publicKey
+
+	endpoint, err := p.String("  Endpoint (optional)", "", func(answer string) error {
+		newPeerConf := peerConf
+		newPeerConf.Endpoint = answer
+		return validatePeer(newPeerConf, "endpoint")
+	})
+	if err != nil {
+		return nil, err
+	}
+	peerConf.Endpoint = endpoint
+
+	ips, err := p.List("  IP address/s", nil, func(ips []string) error {
+		if err := requireIPs(ips); err != nil {
+			return err
+		}
+
+		newPeerConf := peerConf
+		newPeerConf.IPs = ips
+		return validatePeer(newPeerConf, "ips")
+	})
+	if err != nil {
+		return nil, err
+	}
+	peerConf.IPs = ips
+
+	return &peerConf, nil
+}
+
+func requireIPs(ips []string) error {
+	if len(ips) == 0 {
+		return errors.New("at least one IP address is required")
+	}
+
+	return validate.IPs(ips)
+}
+
+// initDefaults fills in default values for any unset configuration options.
+func initDefaults(logger *slog.Logger, hostname string, listenPort int, ips []string) (string, int, []string, error) {
 	if hostname == "" {
 		var err error
 		hostname, err = os.Hostname()
@@ -36,38 +221,45 @@ func Init(logger *slog.Logger, configPath string, hostname string,
 		listenPort = util.RandomInt(49152, 65536)
 	}
 
-	if len(ips) > 0 {
-		if err := validate.IPs(ips); err != nil {
-			return fmt.Errorf("invalid IP address: %w", err)
-		}
-	} else {
+	if len(ips) == 0 {
 		prefix, err := ula.Generate()
 		if err != nil {
-			return fmt.Errorf("failed to generate random ULA prefix: %w", err)
+			return "", 0, nil, fmt.Errorf("failed to generate random ULA prefix: %w", err)
 		}
 
 		ips = append(ips, prefix.Addr().Next().String())
 	}
 
+	return hostname, listenPort, ips, nil
+}
+
+func initConfig(logger *slog.Logger, configPath string, hostname string, listenPort int,
+	ips []string, domain string, peers []latestconfig.PeerConfig) (*latestconfig.Config, error) {
 	privateKey, err := types.NewPrivateKey()
 	if err != nil {
-		return fmt.Errorf("failed to generate private key: %w", err)
+		return nil, fmt.Errorf("failed to generate private key: %w", err)
 	}
 
-	return util.UpdateConfig(logger, configPath, func(_ *latestconfig.Config) (*latestconfig.Config, error) {
-		conf := &latestconfig.Config{
-			Name:       hostname,
-			ListenPort: uint16(listenPort),
-			PrivateKey: privateKey.String(),
-			IPs:        ips,
-		}
+	conf := &latestconfig.Config{
+		Name:       hostname,
+		ListenPort: uint16(listenPort),
+		PrivateKey: privateKey.String(),
+		IPs:        ips,
+		Peers:      peers,
+	}
 
-		if domain != "" {
-			conf.DNS = &latestconfig.DNSConfig{
-				Domain: domain,
-			}
+	if domain != "" {
+		conf.DNS = &latestconfig.DNSConfig{
+			Domain: domain,
 		}
+	}
 
+	err = util.UpdateConfig(logger, configPath, func(_ *latestconfig.Config) (*latestconfig.Config, error) {
 		return conf, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
 }
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitInteractive(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+
+	script := strings.Join([]string{
+		// Peer name, listen port.
+		"a",
+		"51820",
+		// IPs.
+		"100.64.0.1,100.64.0.1",
+		"100.64.0.1",
+		// Domain.
+		"",
+		// First peer.
+		"y",
+		"b",
+		"u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=",
+		"",
+		"100.64.0.2",
+		// Second peer, with a duplicate public key and IP.
+		"y",
+		"c",
+		"u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=",
+		"dQRNHvJbAyB8UPsLYdzGXG1XYlHAYVbCVVTpCn0G9xY=",
+		"",
+		"100.64.0.2",
+		"100.64.0.3",
+		"n",
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	err := config.InitInteractive(logger, configPath, strings.NewReader(script), &out, "", 0, nil, "")
+	require.NoError(t, err)
+
+	require.Contains(t, out.String(), "Invalid answer: duplicate IP address 100.64.0.1 (already assigned to this peer)")
+	require.Contains(t, out.String(), "Invalid answer: duplicate public key (already used by peers[0])")
+	require.Contains(t, out.String(), "Invalid answer: conflicting IP address 100.64.0.2 (already assigned to peers[0])")
+
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+
+	// The written config should pass validation.
+	for _, d := range config.Diagnose(context.Background(), data) {
+		require.NotEqual(t, config.SeverityError, d.Severity, d.String())
+	}
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// prompter reads line oriented answers to questions from the user.
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+func newPrompter(r io.Reader, w io.Writer) *prompter {
+	return &prompter{
+		in:  bufio.NewScanner(r),
+		out: w,
+	}
+}
+
+// String asks the user a question, returning the default value if the
+// answer is empty. The answer is re-requested until validate returns nil.
+func (p *prompter) String(question, defaultValue string, validate func(string) error) (string, error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, defaultValue)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		if !p.in.Scan() {
+			if err := p.in.Err(); err != nil {
+				return "", fmt.Errorf("failed to read answer: %w", err)
+			}
+
+			return "", errors.New("unexpected end of input")
+		}
+
+		answer := strings.TrimSpace(p.in.Text())
+		if answer == "" {
+			answer = defaultValue
+		}
+
+		if validate != nil {
+			if err := validate(answer); err != nil {
+				fmt.Fprintf(p.out, "Invalid answer: %v\n", err)
+				continue
+			}
+		}
+
+		return answer, nil
+	}
+}
+
+// List asks the user for a comma separated list of values.
+func (p *prompter) List(question string, defaultValue []string, validate func([]string) error) ([]string, error) {
+	answer, err := p.String(question, strings.Join(defaultValue, ","), func(answer string) error {
+		if validate == nil {
+			return nil
+		}
+
+		return validate(splitList(answer))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return splitList(answer), nil
+}
+
+// Confirm asks the user a yes/no question.
+func (p *prompter) Confirm(question string, defaultValue bool) (bool, error) {
+	defaultAnswer := "y/N"
+	if defaultValue {
+		defaultAnswer = "Y/n"
+	}
+
+	answer, err := p.String(question, defaultAnswer, func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "y", "yes", "n", "no", strings.ToLower(defaultAnswer):
+			return nil
+		default:
+			return errors.New("expected yes or no")
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	default:
+		return defaultValue, nil
+	}
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
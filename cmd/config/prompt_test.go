@@ -0,0 +1,137 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrompter(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		var out strings.Builder
+		p := newPrompter(strings.NewReader("\n  bad \ngood\n"), &out)
+
+		answer, err := p.String("Name", "default", nil)
+		require.NoError(t, err)
+		require.Equal(t, "default", answer)
+
+		answer, err = p.String("Name", "", func(answer string) error {
+			if answer != "good" {
+				return errors.New("not good")
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "good", answer)
+
+		require.Equal(t, "Name [default]: Name: Invalid answer: not good\nName: ", out.String())
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var out strings.Builder
+		p := newPrompter(strings.NewReader(" a, ,b \n"), &out)
+
+		values, err := p.List("Values", nil, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"a", "b"}, values)
+	})
+
+	t.Run("Confirm", func(t *testing.T) {
+		var out strings.Builder
+		p := newPrompter(strings.NewReader("maybe\nYes\n\n"), &out)
+
+		confirmed, err := p.Confirm("Continue?", false)
+		require.NoError(t, err)
+		require.True(t, confirmed)
+
+		confirmed, err = p.Confirm("Continue?", false)
+		require.NoError(t, err)
+		require.False(t, confirmed)
+
+		require.Contains(t, out.String(), "Invalid answer: expected yes or no")
+	})
+
+	t.Run("End Of Input", func(t *testing.T) {
+		var out strings.Builder
+		p := newPrompter(strings.NewReader("bad\n"), &out)
+
+		_, err := p.String("Name", "", func(string) error {
+			return errors.New("not good")
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestPromptPeer(t *testing.T) {
+	conf := &latestconfig.Config{
+		Name: "a",
+		IPs:  []string{"100.64.0.1"},
+		Peers: []latestconfig.PeerConfig{
+			{Name: "b", PublicKey: "u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=", IPs: []string{"100.64.0.2"}},
+		},
+	}
+
+	script := strings.Join([]string{
+		// Name.
+		"b",
+		"a",
+		"c",
+		// Public key.
+		"dGVzdA==",
+		"u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=",
+		"dQRNHvJbAyB8UPsLYdzGXG1XYlHAYVbCVVTpCn0G9xY=",
+		// Endpoint.
+		"192.0.2.1",
+		"192.0.2.1:http",
+		"192.0.2.1:51820",
+		// IPs.
+		"",
+		"100.64.0.1",
+		"100.64.0.2",
+		"100.64.0.3,100.64.0.3",
+		"100.64.0.3",
+	}, "\n") + "\n"
+
+	var out strings.Builder
+	peerConf, err := promptPeer(newPrompter(strings.NewReader(script), &out), conf)
+	require.NoError(t, err)
+
+	require.Equal(t, &latestconfig.PeerConfig{
+		Name:      "c",
+		PublicKey: "dQRNHvJbAyB8UPsLYdzGXG1XYlHAYVbCVVTpCn0G9xY=",
+		Endpoint:  "192.0.2.1:51820",
+		IPs:       []string{"100.64.0.3"},
+	}, peerConf)
+
+	var invalid []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if _, msg, ok := strings.Cut(line, "Invalid answer: "); ok {
+			invalid = append(invalid, msg)
+		}
+	}
+
+	require.Equal(t, []string{
+		"duplicate name \"b\" (already used by peers[0])",
+		"name \"a\" is the same as this peer's name",
+		"invalid key: expected 32 bytes, got 4",
+		"duplicate public key (already used by peers[0])",
+		"invalid endpoint \"192.0.2.1\": address 192.0.2.1: missing port in address",
+		"invalid endpoint \"192.0.2.1:http\": invalid port \"http\": strconv.Atoi: parsing \"http\": invalid syntax",
+		"at least one IP address is required",
+		"conflicting IP address 100.64.0.1 (already assigned to this peer)",
+		"conflicting IP address 100.64.0.2 (already assigned to peers[0])",
+		"duplicate IP address 100.64.0.3",
+	}, invalid)
+}
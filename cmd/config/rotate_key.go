@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/mdp/qrterminal/v3"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/util"
+	"rsc.io/qr"
+)
+
+// RotateKey replaces the private key in the config with a newly generated one,
+// and prints the new public key along with instructions for updating peers.
+func RotateKey(logger *slog.Logger, configPath string, w io.Writer, qrCode bool) error {
+	var oldPublicKey, newPublicKey types.NoisePublicKey
+	var rotatedConf *latestconfig.Config
+
+	err := util.UpdateConfig(logger, configPath, func(conf *latestconfig.Config) (*latestconfig.Config, error) {
+		if conf == nil {
+			return nil, fmt.Errorf("config file %q does not exist", configPath)
+		}
+
+		var oldPrivateKey types.NoisePrivateKey
+		if err := oldPrivateKey.UnmarshalText([]byte(conf.PrivateKey)); err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+
+		privateKey, err := types.NewPrivateKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate private key: %w", err)
+		}
+
+		oldPublicKey = oldPrivateKey.Public()
+		newPublicKey = privateKey.Public()
+
+		conf.PrivateKey = privateKey.String()
+		rotatedConf = conf
+
+		return conf, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	peerName := rotatedConf.Name
+	if peerName == "" {
+		peerName = oldPublicKey.String()
+	}
+
+	fmt.Fprintf(w, "Private key rotated in %s\n\n", configPath)
+	fmt.Fprintf(w, "  Old public key: %s\n", oldPublicKey.String())
+	fmt.Fprintf(w, "  New public key: %s\n\n", newPublicKey.String())
+	fmt.Fprintf(w, "Peers will not be able to connect until they have been updated with:\n\n")
+	fmt.Fprintf(w, "  nsh peer remove %s\n", peerName)
+	fmt.Fprintf(w, "  %s\n", peerAddCommand(rotatedConf, newPublicKey))
+
+	if qrCode {
+		fmt.Fprintln(w)
+		qrterminal.GenerateHalfBlock(newPublicKey.String(), qr.L, w)
+	}
+
+	return nil
+}
+
+// peerAddCommand returns the command peers can use to add this node, with the
+// given public key.
+func peerAddCommand(conf *latestconfig.Config, publicKey types.NoisePublicKey) string {
+	args := []string{"nsh", "peer", "add"}
+	if conf.Name != "" {
+		args = append(args, "--name="+conf.Name)
+	}
+
+	args = append(args, "--public-key="+publicKey.String())
+
+	for _, ip := range conf.IPs {
+		args = append(args, "--ip="+ip)
+	}
+
+	// A random port is used if none is configured.
+	port := "<PORT>"
+	if conf.ListenPort != 0 {
+		port = strconv.Itoa(int(conf.ListenPort))
+	}
+
+	args = append(args, "--endpoint=<PUBLIC ADDRESS>:"+port)
+
+	return strings.Join(args, " ")
+}
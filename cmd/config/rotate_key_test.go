@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/noisysockets/config"
+	"github.com/noisysockets/noisysockets/types"
+	configcmd "github.com/noisysockets/nsh/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotateKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	const oldPrivateKey = "cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU="
+
+	var oldKey types.NoisePrivateKey
+	require.NoError(t, oldKey.UnmarshalText([]byte(oldPrivateKey)))
+	oldPublicKey := oldKey.Public().String()
+
+	tests := []struct {
+		name        string
+		config      string
+		peerRemove  string
+		peerAddArgs string
+	}{
+		{
+			name: "Named",
+			config: `name: server
+listenPort: 51820
+ips:
+  - 100.64.0.1
+  - fd00::1
+`,
+			peerRemove:  "nsh peer remove server",
+			peerAddArgs: "--name=server --public-key=%s --ip=100.64.0.1 --ip=fd00::1 --endpoint=<PUBLIC ADDRESS>:51820",
+		},
+		{
+			name: "Unnamed Without Port",
+			config: `ips:
+  - 100.64.0.1
+`,
+			peerRemove:  "nsh peer remove " + oldPublicKey,
+			peerAddArgs: "--public-key=%s --ip=100.64.0.1 --endpoint=<PUBLIC ADDRESS>:<PORT>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+			require.NoError(t, os.WriteFile(configPath, []byte(`kind: Config
+apiVersion: noisysockets.github.com/v1alpha2
+privateKey: `+oldPrivateKey+"\n"+tt.config), 0o600))
+
+			var out strings.Builder
+			require.NoError(t, configcmd.RotateKey(logger, configPath, &out, false))
+
+			f, err := os.Open(configPath)
+			require.NoError(t, err)
+			t.Cleanup(func() {
+				_ = f.Close()
+			})
+
+			conf, err := config.FromYAML(f)
+			require.NoError(t, err)
+			require.NotEqual(t, oldPrivateKey, conf.PrivateKey)
+
+			var newKey types.NoisePrivateKey
+			require.NoError(t, newKey.UnmarshalText([]byte(conf.PrivateKey)))
+			newPublicKey := newKey.Public().String()
+
+			require.Contains(t, out.String(), "Old public key: "+oldPublicKey)
+			require.Contains(t, out.String(), "New public key: "+newPublicKey)
+			require.Contains(t, out.String(), "  "+tt.peerRemove+"\n")
+			require.Contains(t, out.String(), "  nsh peer add "+strings.Replace(tt.peerAddArgs, "%s", newPublicKey, 1)+"\n")
+		})
+	}
+}
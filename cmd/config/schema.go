@@ -0,0 +1,358 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"gopkg.in/yaml.v3"
+)
+
+// PrintSchema prints the JSON Schema for the latest configuration format to
+// stdout.
+func PrintSchema() error {
+	schema, err := ConfigSchema()
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(schema); err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+
+	return nil
+}
+
+// ConfigSchema generates a JSON Schema from the latest configuration types.
+func ConfigSchema() (*jsonschema.Schema, error) {
+	r := &jsonschema.Reflector{
+		// The config format is YAML, so use the same field names.
+		FieldNameTag: "yaml",
+		Mapper: func(t reflect.Type) *jsonschema.Schema {
+			if t == reflect.TypeOf(latestconfig.DNSProtocol("")) {
+				return &jsonschema.Schema{
+					AnyOf: []*jsonschema.Schema{
+						{
+							Type: "string",
+							Enum: []any{
+								string(latestconfig.DNSProtocolAuto),
+								string(latestconfig.DNSProtocolUDP),
+								string(latestconfig.DNSProtocolTCP),
+								string(latestconfig.DNSProtocolTLS),
+							},
+						},
+						// The loader is case insensitive.
+						{
+							Type:    "string",
+							Pattern: "^([Uu][Dd][Pp]|[Tt][Cc][Pp]|[Tt][Ll][Ss])$",
+						},
+					},
+				}
+			}
+
+			return nil
+		},
+	}
+
+	schema := r.Reflect(&latestconfig.Config{})
+	schema.Title = "Noisy Sockets Configuration"
+
+	// The type metadata is fixed for the latest config version.
+	conf, ok := schema.Definitions["Config"]
+	if !ok {
+		return nil, fmt.Errorf("missing config definition in schema")
+	}
+
+	if prop, ok := conf.Properties.Get("apiVersion"); ok {
+		prop.Const = latestconfig.APIVersion
+	}
+
+	if prop, ok := conf.Properties.Get("kind"); ok {
+		prop.Const = (&latestconfig.Config{}).GetKind()
+	}
+
+	if prop, ok := conf.Properties.Get("privateKey"); ok {
+		prop.Description = "The base64 encoded private key, or a reference to a key stored in the OS keyring (keyring:<id>)."
+	}
+
+	if prop, ok := conf.Properties.Get("listenPort"); ok {
+		prop.Minimum = json.Number("0")
+		prop.Maximum = json.Number("65535")
+	}
+
+	for _, name := range []string{"listenPort", "mtu"} {
+		if prop, ok := conf.Properties.Get(name); ok {
+			// Numbers can also be set from environment variables.
+			conf.Properties.Set(name, &jsonschema.Schema{
+				AnyOf: []*jsonschema.Schema{prop, envVarSchema()},
+			})
+		}
+	}
+
+	// Peers can also be included from other files.
+	if prop, ok := conf.Properties.Get("peers"); ok && prop.Items != nil {
+		includeProperties := jsonschema.NewProperties()
+		includeProperties.Set("include", &jsonschema.Schema{
+			Type:        "string",
+			Description: "A path (or glob pattern) of files listing peers to include, relative to this file.",
+		})
+
+		prop.Items = &jsonschema.Schema{
+			AnyOf: []*jsonschema.Schema{
+				prop.Items,
+				{
+					Type:                 "object",
+					Properties:           includeProperties,
+					AdditionalProperties: jsonschema.FalseSchema,
+					Required:             []string{"include"},
+				},
+			},
+		}
+	}
+
+	return schema, nil
+}
+
+// envVarSchema matches an environment variable reference (${NAME}, or
+// ${NAME:-default}), for fields that aren't strings.
+func envVarSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{
+		Type:    "string",
+		Pattern: `^\$\{[A-Za-z_][A-Za-z0-9_]*(:-[^}]*)?\}$`,
+	}
+}
+
+// validateSchema checks the YAML document against the configuration schema.
+// Only the subset of JSON Schema used by ConfigSchema is supported.
+func (v *validator) validateSchema(schema *jsonschema.Schema) {
+	node := v.root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	v.checkSchema(schema, schema, node, nil)
+}
+
+func (v *validator) checkSchema(root, schema *jsonschema.Schema, node *yaml.Node, path []any) {
+	schema, ok := resolveSchemaRef(root, schema)
+	if !ok {
+		v.errorf(path, "unknown schema reference %q", schema.Ref)
+		return
+	}
+
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	// The loader leaves null fields unset.
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	if len(schema.AnyOf) > 0 {
+		for _, alt := range schema.AnyOf {
+			probe := &validator{root: v.root}
+			probe.checkSchema(root, alt, node, path)
+			if !probe.hasErrors() && !missingRequired(root, alt, node) {
+				v.diags = append(v.diags, probe.diags...)
+				return
+			}
+		}
+
+		// Report the problems with the closest alternative.
+		closest := schema.AnyOf[0]
+		for _, alt := range schema.AnyOf {
+			if !missingRequired(root, alt, node) {
+				closest = alt
+				break
+			}
+		}
+
+		v.checkSchema(root, closest, node, path)
+		return
+	}
+
+	if schema.Type != "" && !schemaTypeMatches(schema.Type, node) {
+		v.errorf(path, "expected %s, got %s", schemaTypeName(schema.Type), nodeTypeName(node))
+		return
+	}
+
+	if schema.Const != nil && node.Value != fmt.Sprint(schema.Const) {
+		v.errorf(path, "must be %q", schema.Const)
+	}
+
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(value any) bool {
+		return node.Value == fmt.Sprint(value)
+	}) {
+		var values []string
+		for _, value := range schema.Enum {
+			if s := fmt.Sprint(value); s != "" {
+				values = append(values, s)
+			}
+		}
+		v.errorf(path, "unsupported value %q, expected one of: %s", node.Value, strings.Join(values, ", "))
+	}
+
+	if schema.Pattern != "" {
+		if re, err := regexp.Compile(schema.Pattern); err == nil && !re.MatchString(node.Value) {
+			v.errorf(path, "invalid value %q", node.Value)
+		}
+	}
+
+	if schema.Minimum != "" || schema.Maximum != "" {
+		n, _ := strconv.ParseInt(node.Value, 0, 64)
+		if min, err := schema.Minimum.Int64(); err == nil && n < min {
+			v.errorf(path, "%d is less than the minimum of %d", n, min)
+		}
+		if max, err := schema.Maximum.Int64(); err == nil && n > max {
+			v.errorf(path, "%d is greater than the maximum of %d", n, max)
+		}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+
+			var prop *jsonschema.Schema
+			if schema.Properties != nil {
+				prop, _ = schema.Properties.Get(key)
+			}
+
+			if prop == nil {
+				// The loader ignores unknown fields, so they're most likely typos.
+				if schema.AdditionalProperties == jsonschema.FalseSchema {
+					v.warnf(append(slices.Clip(path), key), "unknown field, it will be ignored")
+				}
+				continue
+			}
+
+			v.checkSchema(root, prop, value, append(slices.Clip(path), key))
+		}
+	case yaml.SequenceNode:
+		if schema.Items != nil {
+			for i, item := range node.Content {
+				v.checkSchema(root, schema.Items, item, append(slices.Clip(path), i))
+			}
+		}
+	}
+}
+
+// resolveSchemaRef returns the definition referenced by the schema (if any).
+func resolveSchemaRef(root, schema *jsonschema.Schema) (*jsonschema.Schema, bool) {
+	name, ok := strings.CutPrefix(schema.Ref, "#/$defs/")
+	if !ok {
+		return schema, true
+	}
+
+	def, ok := root.Definitions[name]
+	if !ok {
+		return schema, false
+	}
+
+	return def, true
+}
+
+// missingRequired returns whether the node is missing any fields required by
+// the schema. It's only used to choose between alternatives, as missing
+// fields are otherwise reported when validating the loaded configuration.
+func missingRequired(root, schema *jsonschema.Schema, node *yaml.Node) bool {
+	schema, _ = resolveSchemaRef(root, schema)
+	if node.Kind != yaml.MappingNode {
+		return false
+	}
+
+	for _, name := range schema.Required {
+		var found bool
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == name {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (v *validator) hasErrors() bool {
+	return slices.ContainsFunc(v.diags, func(d Diagnostic) bool {
+		return d.Severity == SeverityError
+	})
+}
+
+func schemaTypeMatches(typ string, node *yaml.Node) bool {
+	switch typ {
+	case "object":
+		return node.Kind == yaml.MappingNode
+	case "array":
+		return node.Kind == yaml.SequenceNode
+	case "string":
+		// Any scalar can be decoded as a string.
+		return node.Kind == yaml.ScalarNode
+	case "integer":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!int"
+	case "number":
+		return node.Kind == yaml.ScalarNode && (node.Tag == "!!int" || node.Tag == "!!float")
+	case "boolean":
+		return node.Kind == yaml.ScalarNode && node.Tag == "!!bool"
+	default:
+		return true
+	}
+}
+
+func schemaTypeName(typ string) string {
+	switch typ {
+	case "object":
+		return "a mapping"
+	case "array":
+		return "a list"
+	case "integer":
+		return "an integer"
+	default:
+		return "a " + typ
+	}
+}
+
+func nodeTypeName(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	}
+
+	switch node.Tag {
+	case "!!int":
+		return "an integer"
+	case "!!float":
+		return "a number"
+	case "!!bool":
+		return "a boolean"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestConfigSchema(t *testing.T) {
+	schema, err := ConfigSchema()
+	require.NoError(t, err)
+
+	check := func(t *testing.T, data string) []Diagnostic {
+		var root yaml.Node
+		require.NoError(t, yaml.Unmarshal([]byte(data), &root))
+
+		v := &validator{root: &root}
+		v.validateSchema(schema)
+
+		return v.diags
+	}
+
+	t.Run("Templated", func(t *testing.T) {
+		// Unexpanded templates are accepted, so the schema can be used by editors.
+		diags := check(t, `apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+privateKey: ${PRIVATE_KEY}
+listenPort: ${LISTEN_PORT:-51820}
+mtu: ${MTU}
+peers:
+  - include: peers/*.yaml
+  - publicKey: u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=
+    endpoint: ${ENDPOINT}
+`)
+		require.Empty(t, diags)
+	})
+
+	t.Run("Invalid Include", func(t *testing.T) {
+		diags := check(t, `apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+peers:
+  - include: [a.yaml]
+`)
+		require.Len(t, diags, 1)
+		require.Equal(t, "error: peers[0].include: expected a string, got a list", diags[0].String())
+	})
+
+	t.Run("Version", func(t *testing.T) {
+		diags := check(t, `apiVersion: noisysockets.github.com/v1alpha1
+kind: Config
+`)
+		require.Len(t, diags, 1)
+		require.Equal(t, "error: apiVersion: must be \"noisysockets.github.com/v1alpha2\"", diags[0].String())
+	})
+}
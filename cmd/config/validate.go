@@ -0,0 +1,539 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/noisysockets/config"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/output"
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/noisysockets/nsh/internal/validate"
+	"gopkg.in/yaml.v3"
+)
+
+// Severity is the severity of a configuration diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// The WireGuard protocol MTU limits (IPv6 requires at least 1280 bytes).
+const (
+	minMTU     = 576
+	minIPv6MTU = 1280
+	// The largest MTU that fits in a standard 1500 byte ethernet frame,
+	// after the WireGuard (and worst case IPv6/UDP) overhead.
+	maxEthernetMTU = 1420
+)
+
+// How long to wait when resolving peer endpoints.
+const resolveTimeout = 5 * time.Second
+
+// Diagnostic is a problem found while validating a configuration file.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	// Line is the line number in the configuration file (if known).
+	Line int `json:"line,omitempty"`
+	// Field is the path of the offending field (eg. peers[0].publicKey).
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationResult is the machine readable result of validating a
+// configuration file.
+type ValidationResult struct {
+	Path        string       `json:"path"`
+	Valid       bool         `json:"valid"`
+	Errors      int          `json:"errors"`
+	Warnings    int          `json:"warnings"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
+
+func (d Diagnostic) String() string {
+	s := string(d.Severity) + ": "
+
+	if d.Field != "" {
+		s += d.Field + ": "
+	}
+
+	return s + d.Message
+}
+
+// Validate checks the configuration file for problems, printing any errors
+// and warnings found (in the given output format). An error is returned if
+// the configuration is invalid, or if strict is true and there are warnings.
+func Validate(ctx context.Context, w io.Writer, configPath string, strict bool, format string) error {
+	if err := output.Validate(format); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if util.IsEncrypted(data) {
+		passphrase, err := util.ReadPassphrase(false)
+		if err != nil {
+			return err
+		}
+
+		data, err = util.Decrypt(data, passphrase)
+		if err != nil {
+			return fmt.Errorf("error decrypting config: %w", err)
+		}
+	}
+
+	data, err = util.ExpandConfig(data, filepath.Dir(configPath))
+	if err != nil {
+		return fmt.Errorf("error expanding config: %w", err)
+	}
+
+	diags := Diagnose(ctx, data)
+
+	var errorCount, warningCount int
+	for _, d := range diags {
+		switch d.Severity {
+		case SeverityError:
+			errorCount++
+		case SeverityWarning:
+			warningCount++
+		}
+	}
+
+	valid := errorCount == 0 && (!strict || warningCount == 0)
+
+	if !output.IsHuman(format) {
+		if diags == nil {
+			diags = []Diagnostic{}
+		}
+
+		if err := output.Write(w, format, ValidationResult{
+			Path:        configPath,
+			Valid:       valid,
+			Errors:      errorCount,
+			Warnings:    warningCount,
+			Diagnostics: diags,
+		}); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diags {
+			if d.Line > 0 {
+				fmt.Fprintf(w, "%s:%d: %s\n", configPath, d.Line, d)
+			} else {
+				fmt.Fprintf(w, "%s: %s\n", configPath, d)
+			}
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("config is invalid (%d errors, %d warnings)", errorCount, warningCount)
+	}
+
+	if output.IsHuman(format) {
+		fmt.Fprintf(w, "%s: config is valid (%d warnings)\n", configPath, warningCount)
+	}
+
+	return nil
+}
+
+// Diagnose returns any problems found in the given (unencrypted)
+// configuration file data.
+func Diagnose(ctx context.Context, data []byte) []Diagnostic {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || apiVersionOf(&root) != latestconfig.APIVersion {
+		// Migrated configs don't share the same layout so can't be referenced.
+		root = yaml.Node{}
+	}
+
+	v := &validator{root: &root}
+
+	if root.Kind != 0 {
+		schema, err := ConfigSchema()
+		if err != nil {
+			v.errorf(nil, "%v", err)
+		} else {
+			v.validateSchema(schema)
+		}
+	}
+
+	conf, err := config.FromYAML(bytes.NewReader(data))
+	if err != nil {
+		// The schema errors point at the offending field.
+		if v.hasErrors() {
+			return v.diags
+		}
+
+		return append(v.diags, Diagnostic{
+			Severity: SeverityError,
+			Line:     yamlErrorLine(err),
+			Message:  err.Error(),
+		})
+	}
+
+	v.validate(ctx, conf)
+
+	return v.diags
+}
+
+// apiVersionOf returns the apiVersion of the YAML document (if any).
+func apiVersionOf(root *yaml.Node) string {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return ""
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "apiVersion" {
+			return doc.Content[i+1].Value
+		}
+	}
+
+	return ""
+}
+
+type validator struct {
+	root  *yaml.Node
+	diags []Diagnostic
+	// offline skips checks that need the network (eg. resolving endpoints).
+	offline bool
+}
+
+// validateField validates the configuration, returning the first error found
+// in the field at the given path (or any of its children). This allows
+// individual answers to be checked using the same rules as config validate.
+func validateField(conf *latestconfig.Config, path ...any) error {
+	v := &validator{root: &yaml.Node{}, offline: true}
+	v.validate(context.Background(), conf)
+
+	field := fieldName(path)
+	for _, d := range v.diags {
+		if d.Severity == SeverityError &&
+			(d.Field == field || strings.HasPrefix(d.Field, field+".") || strings.HasPrefix(d.Field, field+"[")) {
+			return errors.New(d.Message)
+		}
+	}
+
+	return nil
+}
+
+func (v *validator) errorf(path []any, format string, a ...any) {
+	v.add(SeverityError, path, format, a...)
+}
+
+func (v *validator) warnf(path []any, format string, a ...any) {
+	v.add(SeverityWarning, path, format, a...)
+}
+
+func (v *validator) add(severity Severity, path []any, format string, a ...any) {
+	v.diags = append(v.diags, Diagnostic{
+		Severity: severity,
+		Line:     lineOf(v.root, path),
+		Field:    fieldName(path),
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+func (v *validator) validate(ctx context.Context, conf *latestconfig.Config) {
+	var publicKey string
+	if _, ok := util.KeyringID(conf.PrivateKey); !ok {
+		var privateKey types.NoisePrivateKey
+		if conf.PrivateKey == "" {
+			v.errorf([]any{"privateKey"}, "private key is required")
+		} else if err := validate.Key(conf.PrivateKey); err != nil {
+			v.errorf([]any{"privateKey"}, "%v", err)
+		} else if err := privateKey.UnmarshalText([]byte(conf.PrivateKey)); err == nil {
+			publicKey = privateKey.Public().String()
+		}
+	}
+
+	// Addresses that are already assigned, and who they're assigned to.
+	assigned := make(map[netip.Addr]string)
+
+	var hasIPv6 bool
+	for i, ip := range conf.IPs {
+		path := []any{"ips", i}
+
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			v.errorf(path, "invalid IP address %q", ip)
+			continue
+		}
+
+		if owner, ok := assigned[addr]; ok {
+			v.errorf(path, "duplicate IP address %s (already assigned to %s)", addr, owner)
+			continue
+		}
+		assigned[addr] = "this peer"
+
+		hasIPv6 = hasIPv6 || addr.Is6()
+	}
+
+	if len(conf.IPs) == 0 {
+		v.warnf([]any{"ips"}, "no IP addresses assigned, this peer will not be reachable")
+	}
+
+	if conf.MTU != 0 {
+		path := []any{"mtu"}
+
+		switch {
+		case conf.MTU < minMTU:
+			v.errorf(path, "MTU %d is below the minimum of %d", conf.MTU, minMTU)
+		case hasIPv6 && conf.MTU < minIPv6MTU:
+			v.errorf(path, "MTU %d is below the IPv6 minimum of %d", conf.MTU, minIPv6MTU)
+		case conf.MTU > maxEthernetMTU:
+			v.warnf(path, "MTU %d is larger than %d, packets may be fragmented (or dropped) on ethernet networks",
+				conf.MTU, maxEthernetMTU)
+		}
+	}
+
+	if conf.DNS != nil {
+		for i, server := range conf.DNS.Servers {
+			if _, err := parseAddrPort(server); err != nil {
+				v.errorf([]any{"dns", "servers", i}, "invalid DNS server %q", server)
+			}
+		}
+	}
+
+	names := make(map[string]int)
+	publicKeys := make(map[string]int)
+	for i, peerConf := range conf.Peers {
+		v.validatePeer(ctx, i, peerConf, conf, publicKey, names, publicKeys, assigned)
+	}
+
+	destinations := make(map[netip.Prefix]int)
+	for i, routeConf := range conf.Routes {
+		path := []any{"routes", i}
+
+		destination, err := netip.ParsePrefix(routeConf.Destination)
+		if err != nil {
+			v.errorf(append(path, "destination"), "invalid destination %q", routeConf.Destination)
+		} else {
+			if j, ok := destinations[destination.Masked()]; ok {
+				v.errorf(append(path, "destination"), "destination %s is already routed by routes[%d]", destination, j)
+			} else {
+				destinations[destination.Masked()] = i
+			}
+
+			if destination != destination.Masked() {
+				v.warnf(append(path, "destination"), "destination %s has host bits set (did you mean %s?)",
+					destination, destination.Masked())
+			}
+
+			via := fmt.Sprintf("peers[%d]", peerIndex(conf, routeConf.Via))
+
+			var overlapping []netip.Addr
+			for addr, owner := range assigned {
+				if destination.Contains(addr) && owner != via {
+					overlapping = append(overlapping, addr)
+				}
+			}
+			slices.SortFunc(overlapping, netip.Addr.Compare)
+
+			for _, addr := range overlapping {
+				v.warnf(append(path, "destination"), "destination %s overlaps with %s assigned to %s",
+					destination, addr, assigned[addr])
+			}
+		}
+
+		if peerIndex(conf, routeConf.Via) < 0 {
+			v.errorf(append(path, "via"), "unknown peer %q", routeConf.Via)
+		}
+	}
+}
+
+func (v *validator) validatePeer(ctx context.Context, i int, peerConf latestconfig.PeerConfig, conf *latestconfig.Config,
+	publicKey string, names, publicKeys map[string]int, assigned map[netip.Addr]string) {
+	path := []any{"peers", i}
+	owner := fmt.Sprintf("peers[%d]", i)
+
+	if peerConf.Name != "" {
+		if j, ok := names[peerConf.Name]; ok {
+			v.errorf(append(path, "name"), "duplicate name %q (already used by peers[%d])", peerConf.Name, j)
+		} else {
+			names[peerConf.Name] = i
+		}
+
+		if peerConf.Name == conf.Name {
+			v.errorf(append(path, "name"), "name %q is the same as this peer's name", peerConf.Name)
+		}
+	}
+
+	if err := validate.Key(peerConf.PublicKey); err != nil {
+		v.errorf(append(path, "publicKey"), "%v", err)
+	} else if j, ok := publicKeys[peerConf.PublicKey]; ok {
+		v.errorf(append(path, "publicKey"), "duplicate public key (already used by peers[%d])", j)
+	} else if peerConf.PublicKey == publicKey {
+		v.errorf(append(path, "publicKey"), "public key is the same as this peer's public key")
+	} else {
+		publicKeys[peerConf.PublicKey] = i
+	}
+
+	for j, ip := range peerConf.IPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			v.errorf(append(path, "ips", j), "invalid IP address %q", ip)
+			continue
+		}
+
+		if other, ok := assigned[addr]; ok {
+			if other == owner {
+				v.errorf(append(path, "ips", j), "duplicate IP address %s", addr)
+			} else {
+				v.errorf(append(path, "ips", j), "conflicting IP address %s (already assigned to %s)", addr, other)
+			}
+			continue
+		}
+		assigned[addr] = owner
+	}
+
+	if peerConf.Endpoint != "" {
+		host, port, err := stdnet.SplitHostPort(peerConf.Endpoint)
+		if err != nil {
+			v.errorf(append(path, "endpoint"), "invalid endpoint %q: %v", peerConf.Endpoint, err)
+			return
+		}
+
+		if err := validate.PortString(port); err != nil {
+			v.errorf(append(path, "endpoint"), "invalid endpoint %q: %v", peerConf.Endpoint, err)
+			return
+		}
+
+		if _, err := netip.ParseAddr(host); err != nil && !v.offline {
+			resolveCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+			defer cancel()
+
+			if _, err := stdnet.DefaultResolver.LookupHost(resolveCtx, host); err != nil {
+				v.warnf(append(path, "endpoint"), "unable to resolve endpoint host %q: %v", host, err)
+			}
+		}
+	}
+}
+
+func peerIndex(conf *latestconfig.Config, nameOrPublicKey string) int {
+	for i, peerConf := range conf.Peers {
+		if peerConf.PublicKey == nameOrPublicKey || (peerConf.Name != "" && peerConf.Name == nameOrPublicKey) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func parseAddrPort(s string) (netip.AddrPort, error) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+
+	return netip.AddrPortFrom(addr, 0), nil
+}
+
+// lineOf returns the line number of the YAML node at the given path (of map
+// keys and sequence indices), or of the closest ancestor that exists.
+func lineOf(root *yaml.Node, path []any) int {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	line := node.Line
+
+	for _, elem := range path {
+		var next *yaml.Node
+		switch elem := elem.(type) {
+		case string:
+			if node.Kind == yaml.MappingNode {
+				for i := 0; i+1 < len(node.Content); i += 2 {
+					if node.Content[i].Value == elem {
+						next = node.Content[i+1]
+						break
+					}
+				}
+			}
+		case int:
+			if node.Kind == yaml.SequenceNode && elem < len(node.Content) {
+				next = node.Content[elem]
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		node = next
+		line = node.Line
+	}
+
+	return line
+}
+
+func fieldName(path []any) string {
+	var s string
+	for _, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			if s != "" {
+				s += "."
+			}
+			s += elem
+		case int:
+			s += fmt.Sprintf("[%d]", elem)
+		}
+	}
+
+	return s
+}
+
+var yamlLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// yamlErrorLine extracts the line number from a YAML parsing error.
+func yamlErrorLine(err error) int {
+	var typeErr *yaml.TypeError
+	msg := err.Error()
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+
+	if m := yamlLineRegexp.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+
+	return 0
+}
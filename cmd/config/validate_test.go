@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnose(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		diags := config.Diagnose(context.Background(), []byte(`apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+name: a
+privateKey: mJPQRdiuqGR1SgLUEdp0UuJPvXpY0Sl5qE6vBuZwFkY=
+ips:
+  - 100.64.0.1
+peers:
+  - name: b
+    publicKey: u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=
+    endpoint: 192.0.2.1:51820
+    ips:
+      - 100.64.0.2
+routes:
+  - destination: 10.0.0.0/8
+    via: b
+`))
+		require.Empty(t, diags)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		diags := config.Diagnose(context.Background(), []byte(`apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+name: a
+privateKey: mJPQRdiuqGR1SgLUEdp0UuJPvXpY0Sl5qE6vBuZwFkY=
+mtu: 1500
+ips:
+  - 100.64.0.1
+peers:
+  - name: b
+    publicKey: u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=
+    ips:
+      - 100.64.0.1
+  - name: b
+    publicKey: dGVzdA==
+routes:
+  - destination: 10.0.0.0/8
+    via: c
+`))
+
+		var got []string
+		for _, d := range diags {
+			got = append(got, d.String())
+		}
+
+		require.Equal(t, []string{
+			"warning: mtu: MTU 1500 is larger than 1420, packets may be fragmented (or dropped) on ethernet networks",
+			"error: peers[0].ips[0]: conflicting IP address 100.64.0.1 (already assigned to this peer)",
+			"error: peers[1].name: duplicate name \"b\" (already used by peers[0])",
+			"error: peers[1].publicKey: invalid key: expected 32 bytes, got 4",
+			"error: routes[0].via: unknown peer \"c\"",
+		}, got)
+
+		var lines []int
+		for _, d := range diags {
+			lines = append(lines, d.Line)
+		}
+
+		require.Equal(t, []int{5, 12, 13, 14, 17}, lines)
+	})
+
+	t.Run("Valid Schema", func(t *testing.T) {
+		// Everything the loader accepts should also pass the schema.
+		diags := config.Diagnose(context.Background(), []byte(`apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+name: a
+listenPort: 51820
+privateKey: keyring:a
+mtu: 1280
+ips:
+  - 100.64.0.1
+  - fd00::1
+dns:
+  protocol: UDP
+  domain: example.internal
+  servers:
+    - 100.64.0.2
+peers:
+  - name: b
+    publicKey: u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=
+    ips:
+      - 100.64.0.2
+  - publicKey: dQRNHvJbAyB8UPsLYdzGXG1XYlHAYVbCVVTpCn0G9xY=
+    endpoint: 192.0.2.1:51820
+    ips: []
+    name: ~
+routes: []
+`))
+		require.Empty(t, diags)
+	})
+
+	t.Run("Schema", func(t *testing.T) {
+		diags := config.Diagnose(context.Background(), []byte(`apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+privateKey: mJPQRdiuqGR1SgLUEdp0UuJPvXpY0Sl5qE6vBuZwFkY=
+listenPort: 70000
+ips:
+  - 100.64.0.1
+dns:
+  protocol: quic
+peers:
+  - name: b
+    publicKey: u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=
+    allowedIPs:
+      - 100.64.0.2
+`))
+
+		var got []string
+		var lines []int
+		for _, d := range diags {
+			got = append(got, d.String())
+			lines = append(lines, d.Line)
+		}
+
+		require.Equal(t, []string{
+			"error: listenPort: 70000 is greater than the maximum of 65535",
+			"error: dns.protocol: unsupported value \"quic\", expected one of: udp, tcp, tls",
+			"warning: peers[0].allowedIPs: unknown field, it will be ignored",
+		}, got)
+		require.Equal(t, []int{4, 8, 13}, lines)
+	})
+
+	t.Run("Type Error", func(t *testing.T) {
+		diags := config.Diagnose(context.Background(), []byte(`apiVersion: noisysockets.github.com/v1alpha2
+kind: Config
+privateKey: mJPQRdiuqGR1SgLUEdp0UuJPvXpY0Sl5qE6vBuZwFkY=
+mtu: large
+`))
+		require.Len(t, diags, 1)
+
+		require.Equal(t, "error: mtu: expected an integer, got \"large\"", diags[0].String())
+		require.Equal(t, 4, diags[0].Line)
+	})
+
+	t.Run("Syntax Error", func(t *testing.T) {
+		diags := config.Diagnose(context.Background(), []byte("apiVersion: [\n"))
+		require.Len(t, diags, 1)
+
+		require.Equal(t, config.SeverityError, diags[0].Severity)
+	})
+}
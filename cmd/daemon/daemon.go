@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	statuscmd "github.com/noisysockets/nsh/cmd/status"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/control"
+	"github.com/noisysockets/nsh/internal/service"
+	"golang.org/x/sync/errgroup"
+)
+
+// Daemon opens the WireGuard network and keeps it open until interrupted,
+// serving the control API on the given Unix socket so that other commands
+// can make use of the network. Any additional services are run alongside the
+// control API.
+func Daemon(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, socketPath string, services []service.Service) error {
+	if _, err := control.Dial(socketPath); err == nil {
+		return fmt.Errorf("daemon is already running (socket %q)", socketPath)
+	}
+
+	// Remove any stale socket left behind by a previous daemon.
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	return upcmd.Up(ctx, logger, conf, append([]service.Service{
+		&controlService{
+			logger:     logger,
+			conf:       conf,
+			socketPath: socketPath,
+		},
+	}, services...))
+}
+
+var _ service.Service = (*controlService)(nil)
+
+type controlService struct {
+	logger     *slog.Logger
+	conf       *latestconfig.Config
+	socketPath string
+}
+
+func (s *controlService) Serve(ctx context.Context, net network.Network) error {
+	lis, err := stdnet.Listen("unix", s.socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.socketPath, err)
+	}
+	defer lis.Close()
+
+	// Only the current user should be able to control the daemon.
+	if err := os.Chmod(s.socketPath, 0o600); err != nil {
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	s.logger.Info("Listening for control connections", slog.String("socket", s.socketPath))
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+control.StatusPath, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(statuscmd.Peers(r.Context(), net, s.conf)); err != nil {
+			s.logger.Warn("Failed to write status", slog.Any("error", err))
+		}
+	})
+
+	mux.HandleFunc("POST "+control.ForwardPath, func(w http.ResponseWriter, r *http.Request) {
+		var forwardReq control.ForwardRequest
+		if err := json.NewDecoder(r.Body).Decode(&forwardReq); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		direction := service.ForwardDirection(forwardReq.Direction)
+		if direction != service.ForwardLocal && direction != service.ForwardRemote {
+			http.Error(w, fmt.Sprintf("invalid direction %q", forwardReq.Direction), http.StatusBadRequest)
+			return
+		}
+
+		protocol := forwardReq.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		if protocol != "tcp" && protocol != "udp" {
+			http.Error(w, fmt.Sprintf("invalid protocol %q", forwardReq.Protocol), http.StatusBadRequest)
+			return
+		}
+
+		// The forward lasts for as long as the client keeps the request open.
+		w.WriteHeader(http.StatusOK)
+		_ = http.NewResponseController(w).Flush()
+
+		forwardService := service.Forward(s.logger, network.Host(), direction, protocol, forwardReq.ListenAddr, forwardReq.DialAddr)
+		if err := forwardService.Serve(r.Context(), net); err != nil {
+			s.logger.Warn("Failed to forward connections", slog.Any("error", err))
+
+			fmt.Fprintln(w, err.Error())
+		}
+	})
+
+	mux.HandleFunc("POST "+control.DialPath, func(w http.ResponseWriter, r *http.Request) {
+		var dialReq control.DialRequest
+		if err := json.NewDecoder(r.Body).Decode(&dialReq); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// Datagrams can't be tunnelled over a stream.
+		if dialReq.Network != "tcp" {
+			http.Error(w, fmt.Sprintf("unsupported network %q", dialReq.Network), http.StatusBadRequest)
+			return
+		}
+
+		ctx := r.Context()
+
+		upstreamConn, err := net.DialContext(ctx, dialReq.Network, dialReq.Address)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to connect to %s: %v", dialReq.Address, err), http.StatusBadGateway)
+			return
+		}
+		defer upstreamConn.Close()
+
+		conn, err := control.AcceptDial(w)
+		if err != nil {
+			s.logger.Warn("Failed to accept dial", slog.Any("error", err))
+			return
+		}
+		defer conn.Close()
+
+		s.logger.Debug("Tunnelling connection", slog.String("address", dialReq.Address))
+
+		// Hijacked connections aren't closed when the server shuts down.
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.Close()
+			_ = upstreamConn.Close()
+		})
+		defer stop()
+
+		if err := service.Splice(conn, upstreamConn); err != nil && ctx.Err() == nil {
+			s.logger.Warn("Failed to tunnel connection", slog.String("address", dialReq.Address), slog.Any("error", err))
+		}
+	})
+
+	srv := &http.Server{
+		Handler: mux,
+		// Cancel long running requests (eg. forwards) when shutting down.
+		BaseContext: func(stdnet.Listener) context.Context {
+			return ctx
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	})
+
+	g.Go(func() error {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package directory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	stdnet "net"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/directory"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/validate"
+	"golang.org/x/sync/errgroup"
+)
+
+// ServeOptions are the options for the directory server.
+type ServeOptions struct {
+	// ListenAddr is the host network address to listen on.
+	ListenAddr string
+	// TLSCertFile and TLSKeyFile enable HTTPS if set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ClientCAFile enables mutual TLS if set, clients must present a
+	// certificate signed by one of the CAs in the file.
+	ClientCAFile string
+	directory.ServerConfig
+}
+
+// Serve runs a directory server on the host network until interrupted.
+func Serve(ctx context.Context, logger *slog.Logger, opts *ServeOptions) error {
+	if (opts.TLSCertFile == "") != (opts.TLSKeyFile == "") {
+		return errors.New("both a TLS certificate and key are required")
+	}
+
+	if opts.ClientCAFile != "" && opts.TLSCertFile == "" {
+		return errors.New("mutual TLS requires a TLS certificate and key")
+	}
+
+	if opts.Token == "" {
+		logger.Warn("No token configured, anyone will be able to register peers")
+	}
+
+	handler, err := directory.NewServer(logger, opts.ServerConfig)
+	if err != nil {
+		return err
+	}
+
+	lis, err := stdnet.Listen("tcp", opts.ListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", opts.ListenAddr, err)
+	}
+	defer lis.Close()
+
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if opts.ClientCAFile != "" {
+		pool, err := loadCertPool(opts.ClientCAFile)
+		if err != nil {
+			return err
+		}
+
+		srv.TLSConfig = &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  pool,
+		}
+	}
+
+	logger.Info("Listening for directory connections", slog.String("address", lis.Addr().String()))
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	})
+
+	g.Go(func() error {
+		var err error
+		if opts.TLSCertFile != "" {
+			err = srv.ServeTLS(lis, opts.TLSCertFile, opts.TLSKeyFile)
+		} else {
+			err = srv.Serve(lis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// Service returns a service that registers this peer with the directory at
+// the given URL, and adds the other registered peers to the network. The
+// endpoint is the (optional) address other peers can reach this peer on. If
+// the directory requires mutual TLS, the client certificate and key files
+// must be provided.
+func Service(logger *slog.Logger, conf *latestconfig.Config, url, token, endpoint string,
+	interval time.Duration, tlsCertFile, tlsKeyFile string) (service.Service, error) {
+	if endpoint != "" {
+		if err := validate.Endpoint(endpoint); err != nil {
+			return nil, err
+		}
+	}
+
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		return nil, errors.New("both a TLS client certificate and key are required")
+	}
+
+	var tlsConf *tls.Config
+	if tlsCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCertFile, tlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate: %w", err)
+		}
+
+		tlsConf = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	var privateKey types.NoisePrivateKey
+	if err := privateKey.UnmarshalText([]byte(conf.PrivateKey)); err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	self := &directory.Peer{
+		Name:      conf.Name,
+		PublicKey: privateKey.Public().String(),
+		Endpoint:  endpoint,
+		IPs:       conf.IPs,
+	}
+
+	return service.Directory(logger.With(slog.String("directory", url)),
+		directory.NewClient(url, token, tlsConf), self, conf, interval), nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in client CA file %q", path)
+	}
+
+	return pool, nil
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package dns
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/util"
+)
+
+// Serve opens the WireGuard network and serves DNS queries for peer names
+// on the given host addresses, and optionally the WireGuard network, until
+// interrupted. Queries for names in any of the split domains are forwarded to
+// the DNS servers on the WireGuard network, and queries for other names are
+// forwarded to the system resolver.
+func Serve(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, listenAddrs []string,
+	listenOnNetwork bool, splitDomains []string) error {
+	var hostListenAddrs []string
+	for _, addr := range listenAddrs {
+		if addr != "" {
+			hostListenAddrs = append(hostListenAddrs, addr)
+		}
+	}
+
+	if len(hostListenAddrs) == 0 && !listenOnNetwork {
+		return errors.New("at least one listen address is required")
+	}
+
+	if len(splitDomains) > 0 && (conf.DNS == nil || len(conf.DNS.Servers) == 0) {
+		return errors.New("split domains require a DNS server on the WireGuard network, add one with `nsh dns server add`")
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.DNS(logger, &service.DNSServiceConfig{
+			Hosts:                  util.Hosts(conf),
+			DisableNetworkListener: !listenOnNetwork,
+			HostNet:                network.Host(),
+			HostListenAddrs:        hostListenAddrs,
+			SplitDomains:           splitDomains,
+		}),
+	})
+}
@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	forwardcmd "github.com/noisysockets/nsh/cmd/forward"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// DefaultPort is the port the Docker API is exposed on by default.
+const DefaultPort = 2375
+
+// How long to wait for the local socket to be created before giving up.
+const connectTimeout = 30 * time.Second
+
+// Expose exposes the Docker daemon listening on dockerSocket to the WireGuard
+// network on the given port, until interrupted.
+func Expose(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	socketPath, dockerSocket string, port int) error {
+	if !service.IsUnixSocket(dockerSocket) {
+		return fmt.Errorf("docker socket %q must be an absolute path", dockerSocket)
+	}
+
+	logger.Warn("Any peer on the WireGuard network will have full access to the Docker daemon",
+		slog.String("dockerSocket", dockerSocket), slog.Int("port", port))
+
+	return forwardcmd.Forward(ctx, logger, conf, socketPath, service.ForwardRemote,
+		[]string{fmt.Sprintf("%d:%s", port, dockerSocket)})
+}
+
+// Connect forwards a local Unix socket to the Docker API exposed by peer. If
+// args is empty connections are forwarded until interrupted, otherwise the
+// command in args is run with DOCKER_HOST pointing at the socket. If
+// listenPath is empty a temporary socket is used.
+func Connect(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	socketPath, peer string, port int, listenPath string, args []string) error {
+	if listenPath == "" {
+		dir, err := os.MkdirTemp("", "nsh-docker-")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		listenPath = filepath.Join(dir, "docker.sock")
+	}
+
+	listenPath, err := filepath.Abs(listenPath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of %q: %w", listenPath, err)
+	}
+
+	mapping := Mapping(listenPath, peer, port)
+	dockerHost := "unix://" + listenPath
+
+	if len(args) == 0 {
+		logger.Info("Forwarding Docker API, use it by setting DOCKER_HOST",
+			slog.String("peer", peer), slog.String("DOCKER_HOST", dockerHost))
+
+		return forwardcmd.Forward(ctx, logger, conf, socketPath, service.ForwardLocal, []string{mapping})
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	forwardErr := make(chan error, 1)
+	go func() {
+		forwardErr <- forwardcmd.Forward(ctx, logger, conf, socketPath, service.ForwardLocal, []string{mapping})
+	}()
+
+	if err := waitForSocket(ctx, listenPath, forwardErr); err != nil {
+		return err
+	}
+
+	logger.Debug("Running command", slog.String("DOCKER_HOST", dockerHost), slog.Any("args", args))
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "DOCKER_HOST="+dockerHost)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	runErr := cmd.Run()
+
+	cancel()
+	if err := <-forwardErr; err != nil {
+		logger.Warn("Failed to forward Docker API", slog.Any("error", err))
+	}
+
+	if runErr != nil {
+		return fmt.Errorf("%s failed: %w", args[0], runErr)
+	}
+
+	return nil
+}
+
+// Mapping returns the local forward mapping from the socket at listenPath to
+// the Docker API exposed on port by peer.
+func Mapping(listenPath, peer string, port int) string {
+	// IPv6 addresses must be enclosed in square brackets.
+	if strings.Contains(peer, ":") {
+		peer = "[" + peer + "]"
+	}
+
+	return strings.Join([]string{listenPath, peer, strconv.Itoa(port)}, ":")
+}
+
+// waitForSocket waits for the forward to start listening on path.
+func waitForSocket(ctx context.Context, path string, forwardErr <-chan error) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(connectTimeout)
+
+	for {
+		if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-forwardErr:
+			if err == nil {
+				err = errors.New("forwarding stopped")
+			}
+
+			return fmt.Errorf("failed to forward Docker API: %w", err)
+		case <-timeout:
+			return errors.New("timed out waiting for Docker API forward")
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package docker_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/docker"
+	"github.com/noisysockets/nsh/cmd/forward"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapping(t *testing.T) {
+	tests := []struct {
+		peer     string
+		dialAddr string
+	}{
+		{"peer1", "peer1:2375"},
+		{"fd00::1", "[fd00::1]:2375"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.peer, func(t *testing.T) {
+			mapping := docker.Mapping("/tmp/docker.sock", tt.peer, docker.DefaultPort)
+
+			protocol, listenAddr, dialAddr, err := forward.ParseMapping(service.ForwardLocal, mapping)
+			require.NoError(t, err)
+
+			require.Equal(t, "tcp", protocol)
+			require.Equal(t, "/tmp/docker.sock", listenAddr)
+			require.Equal(t, tt.dialAddr, dialAddr)
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package forward
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	stdnet "net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/control"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/validate"
+	"golang.org/x/sync/errgroup"
+)
+
+// Forward forwards connections for each of the given port mappings until
+// interrupted. If a daemon is running, connections are forwarded by the
+// daemon, otherwise the WireGuard network is opened.
+func Forward(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	socketPath string, direction service.ForwardDirection, mappings []string) error {
+	forwardReqs := make([]*control.ForwardRequest, 0, len(mappings))
+	for _, mapping := range mappings {
+		protocol, listenAddr, dialAddr, err := ParseMapping(direction, mapping)
+		if err != nil {
+			return err
+		}
+
+		forwardReqs = append(forwardReqs, &control.ForwardRequest{
+			Direction:  string(direction),
+			Protocol:   protocol,
+			ListenAddr: listenAddr,
+			DialAddr:   dialAddr,
+		})
+	}
+
+	if client, err := control.Dial(socketPath); err == nil {
+		logger.Info("Forwarding connections using running daemon", slog.String("socket", socketPath))
+
+		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		g, ctx := errgroup.WithContext(ctx)
+
+		for _, forwardReq := range forwardReqs {
+			g.Go(func() error {
+				if err := client.Forward(ctx, forwardReq); err != nil {
+					return fmt.Errorf("failed to forward %s to %s: %w", forwardReq.ListenAddr, forwardReq.DialAddr, err)
+				}
+
+				return nil
+			})
+		}
+
+		return g.Wait()
+	}
+
+	var services []service.Service
+	for _, forwardReq := range forwardReqs {
+		services = append(services, service.Forward(logger, network.Host(), direction, forwardReq.Protocol, forwardReq.ListenAddr, forwardReq.DialAddr))
+	}
+
+	return upcmd.Up(ctx, logger, conf, services)
+}
+
+// ParseMapping parses a port mapping of the form
+// "[bind_address:]port:host:hostport[/protocol]" into a protocol (tcp or udp),
+// listen and dial address. IPv6 addresses must be enclosed in square brackets.
+// Local forwards can also listen on a Unix socket ("path:host:hostport"), and
+// remote forwards can connect to one ("[bind_address:]port:path").
+func ParseMapping(direction service.ForwardDirection, mapping string) (protocol, listenAddr, dialAddr string, err error) {
+	parts, err := splitMapping(mapping)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid mapping %q: %w", mapping, err)
+	}
+
+	protocol = "tcp"
+	if last := parts[len(parts)-1]; !service.IsUnixSocket(last) {
+		if hostPort, p, ok := strings.Cut(last, "/"); ok {
+			parts[len(parts)-1], protocol = hostPort, p
+		}
+	}
+
+	if protocol != "tcp" && protocol != "udp" {
+		return "", "", "", fmt.Errorf("invalid mapping %q: unsupported protocol %q", mapping, protocol)
+	}
+
+	if service.IsUnixSocket(parts[0]) || service.IsUnixSocket(parts[len(parts)-1]) {
+		listenAddr, dialAddr, err = parseUnixMapping(direction, protocol, parts)
+		if err != nil {
+			return "", "", "", fmt.Errorf("invalid mapping %q: %w", mapping, err)
+		}
+
+		return protocol, listenAddr, dialAddr, nil
+	}
+
+	var bindAddr string
+	switch len(parts) {
+	case 3:
+		// By default local forwards are only reachable from this machine,
+		// while remote forwards are reachable from the whole WireGuard network.
+		if direction == service.ForwardLocal {
+			bindAddr = "localhost"
+		}
+	case 4:
+		bindAddr, parts = parts[0], parts[1:]
+	default:
+		return "", "", "", fmt.Errorf("invalid mapping %q: expected [bind_address:]port:host:hostport[/protocol]", mapping)
+	}
+
+	listenPort, host, hostPort := parts[0], parts[1], parts[2]
+
+	if host == "" {
+		return "", "", "", fmt.Errorf("invalid mapping %q: missing host", mapping)
+	}
+
+	for _, port := range []string{listenPort, hostPort} {
+		if err := validate.PortString(port); err != nil {
+			return "", "", "", fmt.Errorf("invalid mapping %q: %w", mapping, err)
+		}
+	}
+
+	return protocol, stdnet.JoinHostPort(bindAddr, listenPort), stdnet.JoinHostPort(host, hostPort), nil
+}
+
+// parseUnixMapping parses a mapping with a Unix socket on the host side.
+func parseUnixMapping(direction service.ForwardDirection, protocol string, parts []string) (listenAddr, dialAddr string, err error) {
+	if protocol != "tcp" {
+		return "", "", errors.New("only tcp can be forwarded to or from Unix sockets")
+	}
+
+	// Listen on a local Unix socket.
+	if service.IsUnixSocket(parts[0]) {
+		if direction != service.ForwardLocal {
+			return "", "", errors.New("only local forwards can listen on a Unix socket")
+		}
+
+		if len(parts) != 3 {
+			return "", "", errors.New("expected path:host:hostport")
+		}
+
+		host, hostPort := parts[1], parts[2]
+		if host == "" {
+			return "", "", errors.New("missing host")
+		}
+
+		if err := validate.PortString(hostPort); err != nil {
+			return "", "", err
+		}
+
+		return parts[0], stdnet.JoinHostPort(host, hostPort), nil
+	}
+
+	// Connect to a local Unix socket.
+	if direction != service.ForwardRemote {
+		return "", "", errors.New("only remote forwards can connect to a Unix socket")
+	}
+
+	var bindAddr string
+	switch len(parts) {
+	case 2:
+	case 3:
+		bindAddr, parts = parts[0], parts[1:]
+	default:
+		return "", "", errors.New("expected [bind_address:]port:path")
+	}
+
+	if err := validate.PortString(parts[0]); err != nil {
+		return "", "", err
+	}
+
+	return stdnet.JoinHostPort(bindAddr, parts[0]), parts[1], nil
+}
+
+// splitMapping splits a mapping on colons, ignoring any colons within
+// square brackets (eg. IPv6 addresses).
+func splitMapping(mapping string) ([]string, error) {
+	var parts []string
+	var inBrackets bool
+	var part strings.Builder
+
+	for _, c := range mapping {
+		switch {
+		case c == '[' && !inBrackets && part.Len() == 0:
+			inBrackets = true
+		case c == ']' && inBrackets:
+			inBrackets = false
+		case c == ':' && !inBrackets:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteRune(c)
+		}
+	}
+
+	if inBrackets {
+		return nil, errors.New("unterminated square bracket")
+	}
+
+	return append(parts, part.String()), nil
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package forward_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/forward"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMapping(t *testing.T) {
+	tests := []struct {
+		direction  service.ForwardDirection
+		mapping    string
+		protocol   string
+		listenAddr string
+		dialAddr   string
+	}{
+		{service.ForwardLocal, "8080:peer1:80", "tcp", "localhost:8080", "peer1:80"},
+		{service.ForwardRemote, "2222:localhost:22", "tcp", ":2222", "localhost:22"},
+		{service.ForwardLocal, "0.0.0.0:8080:peer1:80", "tcp", "0.0.0.0:8080", "peer1:80"},
+		{service.ForwardLocal, "[::1]:8080:[fd00::1]:80", "tcp", "[::1]:8080", "[fd00::1]:80"},
+		{service.ForwardLocal, "5353:peer1:53/udp", "udp", "localhost:5353", "peer1:53"},
+		{service.ForwardRemote, "8080:localhost:80/tcp", "tcp", ":8080", "localhost:80"},
+		{service.ForwardLocal, "/tmp/docker.sock:peer1:2375", "tcp", "/tmp/docker.sock", "peer1:2375"},
+		{service.ForwardRemote, "2375:/var/run/docker.sock", "tcp", ":2375", "/var/run/docker.sock"},
+		{service.ForwardRemote, "100.64.0.1:2375:/var/run/docker.sock", "tcp", "100.64.0.1:2375", "/var/run/docker.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			protocol, listenAddr, dialAddr, err := forward.ParseMapping(tt.direction, tt.mapping)
+			require.NoError(t, err)
+
+			require.Equal(t, tt.protocol, protocol)
+			require.Equal(t, tt.listenAddr, listenAddr)
+			require.Equal(t, tt.dialAddr, dialAddr)
+		})
+	}
+
+	for _, mapping := range []string{"8080", "8080:peer1", "a:b:c:d:e", "8080::80", "x:peer1:80", "8080:peer1:70000", "8080:[fd00::1:80", "53:peer1:53/sctp",
+		"2375:/var/run/docker.sock", "/tmp/docker.sock:peer1:2375/udp", "/tmp/docker.sock:peer1"} {
+		t.Run(mapping, func(t *testing.T) {
+			_, _, _, err := forward.ParseMapping(service.ForwardLocal, mapping)
+			require.Error(t, err)
+		})
+	}
+}
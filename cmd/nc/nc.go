@@ -0,0 +1,298 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package nc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	stdnet "net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/control"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/validate"
+)
+
+// Options configures a netcat session.
+type Options struct {
+	// UDP is whether to use UDP instead of TCP.
+	UDP bool
+	// Timeout is how long to wait for a connection to be established (0 for
+	// no timeout).
+	Timeout time.Duration
+	// SocketPath is the control socket of a daemon to connect through (if
+	// running), rather than opening the WireGuard network.
+	SocketPath string
+}
+
+// Dial connects to the host and port on the WireGuard network, and copies
+// stdin to the connection and the connection to stdout until the remote end
+// closes the connection.
+func Dial(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	host, port string, opts *Options) error {
+	if err := validate.PortString(port); err != nil {
+		return err
+	}
+
+	s := &ncService{
+		logger: logger,
+		addr:   stdnet.JoinHostPort(host, port),
+		opts:   opts,
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}
+
+	// Only TCP connections can be tunnelled through the daemon.
+	if !opts.UDP && opts.SocketPath != "" {
+		if client, err := control.Dial(opts.SocketPath); err == nil {
+			logger.Debug("Connecting using running daemon", slog.String("socket", opts.SocketPath))
+
+			ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			s.daemon = client
+			return s.Serve(ctx, nil)
+		}
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{s})
+}
+
+// Listen waits for a single connection on the WireGuard network address (or
+// port), and then copies data between it and stdin/stdout.
+func Listen(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	listenAddr string, opts *Options) error {
+	if !strings.Contains(listenAddr, ":") {
+		listenAddr = ":" + listenAddr
+	}
+
+	_, port, err := stdnet.SplitHostPort(listenAddr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+
+	if err := validate.PortString(port); err != nil {
+		return err
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		&ncService{
+			logger: logger,
+			addr:   listenAddr,
+			listen: true,
+			opts:   opts,
+			stdin:  os.Stdin,
+			stdout: os.Stdout,
+		},
+	})
+}
+
+var _ service.Service = (*ncService)(nil)
+
+type ncService struct {
+	logger *slog.Logger
+	addr   string
+	listen bool
+	opts   *Options
+	// daemon, if set, is used to connect rather than the network.
+	daemon *control.Client
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func (s *ncService) Serve(ctx context.Context, net network.Network) error {
+	var conn stdnet.Conn
+	var err error
+	if s.listen {
+		conn, err = s.accept(ctx, net)
+	} else {
+		conn, err = s.dial(ctx, net)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return err
+	}
+	defer conn.Close()
+
+	return pipe(ctx, conn, s.stdin, s.stdout)
+}
+
+func (s *ncService) dial(ctx context.Context, net network.Network) (stdnet.Conn, error) {
+	if s.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Timeout)
+		defer cancel()
+	}
+
+	var conn stdnet.Conn
+	var err error
+	if s.daemon != nil {
+		conn, err = s.daemon.Dial(ctx, s.protocol(), s.addr)
+	} else {
+		conn, err = net.DialContext(ctx, s.protocol(), s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", s.addr, err)
+	}
+
+	s.logger.Debug("Connected", slog.String("address", s.addr))
+
+	return conn, nil
+}
+
+func (s *ncService) accept(ctx context.Context, net network.Network) (stdnet.Conn, error) {
+	if s.opts.UDP {
+		pc, err := net.ListenPacket("udp", s.addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+		}
+
+		s.logger.Info("Listening for packets", slog.String("address", pc.LocalAddr().String()))
+
+		return acceptPacket(ctx, pc)
+	}
+
+	lis, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	defer lis.Close()
+
+	s.logger.Info("Listening for connections", slog.String("address", lis.Addr().String()))
+
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	conn, err := lis.Accept()
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept connection: %w", err)
+	}
+
+	s.logger.Debug("Accepted connection", slog.String("remoteAddr", conn.RemoteAddr().String()))
+
+	return conn, nil
+}
+
+func (s *ncService) protocol() string {
+	if s.opts.UDP {
+		return "udp"
+	}
+
+	return "tcp"
+}
+
+// pipe copies stdin to the connection, and the connection to stdout, until
+// the remote end closes the connection (or the context is cancelled).
+func pipe(ctx context.Context, conn stdnet.Conn, stdin io.Reader, stdout io.Writer) error {
+	stdinErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, stdin)
+		if err != nil {
+			stdinErr <- fmt.Errorf("failed to write to connection: %w", err)
+			return
+		}
+
+		// Let the remote end know we're done sending, but keep reading
+		// until it closes the connection.
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+
+	stdoutErr := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stdout, conn)
+		stdoutErr <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-stdinErr:
+		return err
+	case err := <-stdoutErr:
+		if err != nil && !errors.Is(err, stdnet.ErrClosed) && ctx.Err() == nil {
+			return fmt.Errorf("failed to read from connection: %w", err)
+		}
+
+		return nil
+	}
+}
+
+// packetConn is a packet connection "connected" to the first peer that sent
+// a packet to it.
+type packetConn struct {
+	stdnet.PacketConn
+	remoteAddr stdnet.Addr
+	// pending is the first packet, which hasn't been read yet.
+	pending []byte
+}
+
+// acceptPacket waits for the first packet to arrive, and returns a connection
+// to its sender.
+func acceptPacket(ctx context.Context, pc stdnet.PacketConn) (stdnet.Conn, error) {
+	go func() {
+		<-ctx.Done()
+		_ = pc.Close()
+	}()
+
+	// The largest possible UDP payload.
+	buf := make([]byte, 65535)
+	n, remoteAddr, err := pc.ReadFrom(buf)
+	if err != nil {
+		_ = pc.Close()
+		return nil, fmt.Errorf("failed to read packet: %w", err)
+	}
+
+	return &packetConn{PacketConn: pc, remoteAddr: remoteAddr, pending: buf[:n]}, nil
+}
+
+func (c *packetConn) Read(p []byte) (int, error) {
+	if c.pending != nil {
+		n := copy(p, c.pending)
+		c.pending = nil
+		return n, nil
+	}
+
+	for {
+		n, addr, err := c.ReadFrom(p)
+		if err != nil {
+			return 0, err
+		}
+
+		// Ignore packets from anyone else.
+		if addr.String() == c.remoteAddr.String() {
+			return n, nil
+		}
+	}
+}
+
+func (c *packetConn) Write(p []byte) (int, error) {
+	return c.WriteTo(p, c.remoteAddr)
+}
+
+func (c *packetConn) RemoteAddr() stdnet.Addr {
+	return c.remoteAddr
+}
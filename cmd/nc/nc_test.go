@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package nc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipe(t *testing.T) {
+	// An echo server that closes the connection once the client is done.
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = lis.Close()
+	})
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	var stdout bytes.Buffer
+	require.NoError(t, pipe(context.Background(), conn, strings.NewReader("hello\n"), &stdout))
+
+	require.Equal(t, "hello\n", stdout.String())
+}
+
+func TestAcceptPacket(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	client, err := net.Dial("udp", pc.LocalAddr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	_, err = client.Write([]byte("first"))
+	require.NoError(t, err)
+
+	conn, err := acceptPacket(context.Background(), pc)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	require.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String())
+
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(buf[:n]))
+
+	_, err = conn.Write([]byte("reply"))
+	require.NoError(t, err)
+
+	n, err = client.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "reply", string(buf[:n]))
+}
@@ -13,6 +13,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
 
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
 	"github.com/noisysockets/noisysockets/types"
@@ -35,10 +36,35 @@ func Add(logger *slog.Logger, configPath, name, publicKey, endpoint string, ips
 			return nil, fmt.Errorf("invalid public key: %w", err)
 		}
 
+		// Make sure we aren't trying to add ourselves.
+		var privateKey types.NoisePrivateKey
+		if err := privateKey.UnmarshalText([]byte(conf.PrivateKey)); err == nil && privateKey.Public() == pk {
+			return nil, errors.New("public key belongs to this peer")
+		}
+
 		if err := validate.IPs(ips); err != nil {
 			return nil, fmt.Errorf("invalid IP address: %w", err)
 		}
 
+		// Make sure the IP addresses are not already in use (in any form, eg.
+		// fd00::1 and fd00:0::1 are the same address).
+		for _, ip := range ips {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP address %q: %w", ip, err)
+			}
+
+			if containsAddr(conf.IPs, addr) {
+				return nil, fmt.Errorf("IP address %q is already assigned to this peer", ip)
+			}
+
+			for _, peerConf := range conf.Peers {
+				if containsAddr(peerConf.IPs, addr) {
+					return nil, fmt.Errorf("IP address %q is already assigned to peer %q", ip, peerDisplayName(peerConf))
+				}
+			}
+		}
+
 		if endpoint != "" {
 			if err := validate.Endpoint(endpoint); err != nil {
 				return nil, fmt.Errorf("invalid endpoint: %w", err)
@@ -56,3 +82,22 @@ func Add(logger *slog.Logger, configPath, name, publicKey, endpoint string, ips
 		return conf, nil
 	})
 }
+
+func peerDisplayName(peerConf latestconfig.PeerConfig) string {
+	if peerConf.Name != "" {
+		return peerConf.Name
+	}
+
+	return peerConf.PublicKey
+}
+
+// containsAddr returns whether any of the IP addresses is addr.
+func containsAddr(ips []string, addr netip.Addr) bool {
+	for _, ip := range ips {
+		if other, err := netip.ParseAddr(ip); err == nil && other == addr {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package peer_test
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddDuplicateIP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(`kind: Config
+apiVersion: noisysockets.github.com/v1alpha2
+name: server
+privateKey: cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU=
+ips:
+  - fd00::1
+peers:
+  - name: gateway
+    publicKey: zzZQPVEk52JZhnxNP/iGQnImksI/XfSzdv901MPfPUY=
+    ips:
+      - fd00::2
+`), 0o600))
+
+	const publicKey = "+gfcmfN5MCS5KH8KLLNCME3BSdKp00KTEcawVcrt2ls="
+
+	// The same addresses, written differently.
+	err := peer.Add(logger, configPath, "laptop", publicKey, "", []string{"fd00:0::1"})
+	require.ErrorContains(t, err, "already assigned to this peer")
+
+	err = peer.Add(logger, configPath, "laptop", publicKey, "", []string{"FD00:0:0::2"})
+	require.ErrorContains(t, err, `already assigned to peer "gateway"`)
+
+	require.NoError(t, peer.Add(logger, configPath, "laptop", publicKey, "", []string{"fd00::3"}))
+}
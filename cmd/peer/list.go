@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package peer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/nsh/internal/output"
+)
+
+type peerInfo struct {
+	Name      string   `json:"name,omitempty"`
+	PublicKey string   `json:"publicKey"`
+	Endpoint  string   `json:"endpoint,omitempty"`
+	IPs       []string `json:"ips,omitempty"`
+}
+
+// List prints the configured peers to stdout.
+func List(conf *latestconfig.Config, format string) error {
+	if err := output.Validate(format); err != nil {
+		return err
+	}
+
+	peers := make([]peerInfo, 0, len(conf.Peers))
+	for _, peerConf := range conf.Peers {
+		peers = append(peers, peerInfo{
+			Name:      peerConf.Name,
+			PublicKey: peerConf.PublicKey,
+			Endpoint:  peerConf.Endpoint,
+			IPs:       peerConf.IPs,
+		})
+	}
+
+	if !output.IsHuman(format) {
+		return output.Write(os.Stdout, format, peers)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPUBLIC KEY\tENDPOINT\tIPS")
+	for _, peer := range peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", peer.Name, peer.PublicKey, peer.Endpoint, strings.Join(peer.IPs, ","))
+	}
+	return w.Flush()
+}
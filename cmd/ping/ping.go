@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// Ping opens the WireGuard network and sends ICMP echo requests to the given
+// host, reporting the round trip time of each and a summary of packet loss.
+// If count is zero, pings are sent until interrupted.
+func Ping(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	host string, count int, interval, timeout time.Duration) error {
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		&pingService{
+			host:     host,
+			count:    count,
+			interval: interval,
+			timeout:  timeout,
+			w:        os.Stdout,
+		},
+	})
+}
+
+var _ service.Service = (*pingService)(nil)
+
+type pingService struct {
+	host     string
+	count    int
+	interval time.Duration
+	timeout  time.Duration
+	w        io.Writer
+}
+
+func (s *pingService) Serve(ctx context.Context, net network.Network) error {
+	var sent, received int
+	var minRTT, maxRTT, totalRTT time.Duration
+
+	for seq := 1; s.count == 0 || seq <= s.count; seq++ {
+		if seq > 1 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(s.interval):
+			}
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		rtt, err := s.ping(ctx, net)
+		if ctx.Err() != nil {
+			break
+		}
+
+		sent++
+
+		if err != nil {
+			fmt.Fprintf(s.w, "No reply from %s: seq=%d error=%v\n", s.host, seq, err)
+			continue
+		}
+
+		received++
+		totalRTT += rtt
+		if received == 1 || rtt < minRTT {
+			minRTT = rtt
+		}
+		if rtt > maxRTT {
+			maxRTT = rtt
+		}
+
+		fmt.Fprintf(s.w, "Reply from %s: seq=%d time=%s\n", s.host, seq, rtt.Round(time.Microsecond))
+	}
+
+	if sent == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(s.w, "\n--- %s ping statistics ---\n", s.host)
+	fmt.Fprintf(s.w, "%d packets transmitted, %d received, %.1f%% packet loss\n",
+		sent, received, 100*float64(sent-received)/float64(sent))
+
+	if received == 0 {
+		return errors.New("no replies received")
+	}
+
+	fmt.Fprintf(s.w, "rtt min/avg/max = %s/%s/%s\n", minRTT.Round(time.Microsecond),
+		(totalRTT / time.Duration(received)).Round(time.Microsecond), maxRTT.Round(time.Microsecond))
+
+	return nil
+}
+
+func (s *pingService) ping(ctx context.Context, net network.Network) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	start := time.Now()
+	if err := net.Ping(ctx, "ip", s.host); err != nil {
+		return 0, err
+	}
+
+	return time.Since(start), nil
+}
@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package profile
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/adrg/xdg"
+	configcmd "github.com/noisysockets/nsh/cmd/config"
+	"github.com/noisysockets/nsh/internal/output"
+)
+
+// DefaultProfile is the name of the profile that uses the default
+// configuration file.
+const DefaultProfile = "default"
+
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
+
+// ConfigPath returns the path of the configuration file for the named profile.
+func ConfigPath(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+
+	if name == DefaultProfile {
+		return xdg.ConfigFile("nsh/noisysockets.yaml")
+	}
+
+	return xdg.ConfigFile(filepath.Join("nsh", "profiles", name+".yaml"))
+}
+
+// SocketPath returns the path of the daemon control socket for the named
+// profile, so that daemons for different profiles can run side by side.
+func SocketPath(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+
+	if name == DefaultProfile {
+		return xdg.RuntimeFile("nsh/daemon.sock")
+	}
+
+	return xdg.RuntimeFile(filepath.Join("nsh", "profiles", name+".sock"))
+}
+
+// Profile is a configuration profile, as listed in machine readable output.
+type Profile struct {
+	Name    string `json:"name"`
+	Config  string `json:"config"`
+	Current bool   `json:"current"`
+}
+
+// List writes the names of all profiles and their configuration files (in the
+// given output format). The currently selected profile is marked with an
+// asterisk.
+func List(w io.Writer, current, format string) error {
+	if err := output.Validate(format); err != nil {
+		return err
+	}
+
+	names := []string{DefaultProfile}
+
+	entries, err := os.ReadDir(filepath.Join(xdg.ConfigHome, "nsh", "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to list profiles: %w", err)
+	}
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".yaml")
+		if !ok || entry.IsDir() || validateName(name) != nil || name == DefaultProfile {
+			continue
+		}
+
+		names = append(names, name)
+	}
+
+	sort.Strings(names[1:])
+
+	profiles := make([]Profile, 0, len(names))
+	for _, name := range names {
+		configPath, err := ConfigPath(name)
+		if err != nil {
+			return err
+		}
+
+		profiles = append(profiles, Profile{
+			Name:    name,
+			Config:  configPath,
+			Current: name == current,
+		})
+	}
+
+	if !output.IsHuman(format) {
+		return output.Write(w, format, profiles)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tNAME\tCONFIG")
+
+	for _, profile := range profiles {
+		marker := ""
+		if profile.Current {
+			marker = "*"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", marker, profile.Name, profile.Config)
+	}
+
+	return tw.Flush()
+}
+
+// Create creates a new profile with a freshly generated configuration.
+func Create(logger *slog.Logger, name string, hostname string,
+	listenPort int, ips []string, domain string) error {
+	configPath, err := ConfigPath(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+
+	if err := configcmd.Init(logger, configPath, hostname, listenPort, ips, domain); err != nil {
+		return err
+	}
+
+	logger.Info("Created profile", slog.String("name", name), slog.String("config", configPath))
+
+	return nil
+}
+
+// Delete removes the named profile and its configuration file.
+func Delete(logger *slog.Logger, name string) error {
+	if name == DefaultProfile {
+		return fmt.Errorf("the %q profile cannot be deleted", DefaultProfile)
+	}
+
+	configPath, err := ConfigPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(configPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("profile %q does not exist", name)
+		}
+
+		return fmt.Errorf("failed to delete profile: %w", err)
+	}
+
+	logger.Info("Deleted profile", slog.String("name", name))
+
+	return nil
+}
+
+func validateName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: must contain only letters, digits, '-' and '_'", name)
+	}
+
+	return nil
+}
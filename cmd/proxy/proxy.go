@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/validate"
+)
+
+// SOCKS5 opens the WireGuard network and serves a SOCKS5 proxy on the
+// given host network address until interrupted.
+func SOCKS5(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, listenAddr string) error {
+	if err := validateListenAddr(listenAddr); err != nil {
+		return err
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.SOCKS5(logger, network.Host(), listenAddr),
+	})
+}
+
+// HTTP opens the WireGuard network and serves a HTTP proxy on the given host
+// network address until interrupted.
+func HTTP(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, listenAddr string) error {
+	if err := validateListenAddr(listenAddr); err != nil {
+		return err
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.HTTPProxy(logger, network.Host(), listenAddr),
+	})
+}
+
+func validateListenAddr(listenAddr string) error {
+	_, port, err := stdnet.SplitHostPort(listenAddr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+
+	if err := validate.PortString(port); err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", listenAddr, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package proxycommand
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	nccmd "github.com/noisysockets/nsh/cmd/nc"
+	profilecmd "github.com/noisysockets/nsh/cmd/profile"
+)
+
+// How long to wait for the connection to be established, long enough for a
+// retransmitted handshake.
+const connectTimeout = 15 * time.Second
+
+// ProxyCommand connects stdin and stdout to the given host and port on the
+// WireGuard network, for use as an OpenSSH ProxyCommand. If a daemon is
+// running, the connection is made through it.
+func ProxyCommand(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	socketPath, host, port string) error {
+	return nccmd.Dial(ctx, logger, conf, host, port, &nccmd.Options{
+		Timeout:    connectTimeout,
+		SocketPath: socketPath,
+	})
+}
+
+// SSHConfig writes an OpenSSH client configuration block for each named peer,
+// that connects to it using nsh. The host key of each peer is stored under an
+// alias derived from its WireGuard public key, so it stays pinned to the
+// peer's identity even if its name or addresses change.
+func SSHConfig(w io.Writer, conf *latestconfig.Config, profile string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		executable = "nsh"
+	}
+
+	command := quote(executable)
+	if profile != "" && profile != profilecmd.DefaultProfile {
+		command += " --profile " + quote(profile)
+	}
+
+	for _, peerConf := range conf.Peers {
+		if peerConf.Name == "" {
+			continue
+		}
+
+		alias, err := HostKeyAlias(peerConf.PublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key for peer %q: %w", peerConf.Name, err)
+		}
+
+		hosts := peerConf.Name
+		if conf.DNS != nil && conf.DNS.Domain != "" {
+			hosts += " " + peerConf.Name + "." + strings.TrimSuffix(conf.DNS.Domain, ".")
+		}
+
+		fmt.Fprintf(w, "Host %s\n", hosts)
+		fmt.Fprintf(w, "  ProxyCommand %s proxycommand %%h %%p\n", command)
+		fmt.Fprintf(w, "  HostKeyAlias %s\n", alias)
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
+
+// HostKeyAlias returns the OpenSSH host key alias for the peer with the given
+// public key.
+func HostKeyAlias(publicKey string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(key)
+	return "nsh-" + hex.EncodeToString(sum[:8]), nil
+}
+
+func quote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package proxycommand_test
+
+import (
+	"bytes"
+	"testing"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/nsh/cmd/proxycommand"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSHConfig(t *testing.T) {
+	conf := &latestconfig.Config{
+		DNS: &latestconfig.DNSConfig{Domain: "my.nzzy.net."},
+		Peers: []latestconfig.PeerConfig{
+			{Name: "peer1", PublicKey: "zzZQPVEk52JZhnxNP/iGQnImksI/XfSzdv901MPfPUY="},
+			{PublicKey: "+gfcmfN5MCS5KH8KLLNCME3BSdKp00KTEcawVcrt2ls="},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, proxycommand.SSHConfig(&buf, conf, "work"))
+
+	alias, err := proxycommand.HostKeyAlias(conf.Peers[0].PublicKey)
+	require.NoError(t, err)
+
+	out := buf.String()
+	require.Contains(t, out, "Host peer1 peer1.my.nzzy.net\n")
+	require.Contains(t, out, " --profile work proxycommand %h %p\n")
+	require.Contains(t, out, "  HostKeyAlias "+alias+"\n")
+
+	// Peers without a name are skipped.
+	require.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("Host ")))
+}
+
+func TestHostKeyAlias(t *testing.T) {
+	alias, err := proxycommand.HostKeyAlias("zzZQPVEk52JZhnxNP/iGQnImksI/XfSzdv901MPfPUY=")
+	require.NoError(t, err)
+	require.Regexp(t, `^nsh-[0-9a-f]{16}$`, alias)
+
+	other, err := proxycommand.HostKeyAlias("+gfcmfN5MCS5KH8KLLNCME3BSdKp00KTEcawVcrt2ls=")
+	require.NoError(t, err)
+	require.NotEqual(t, alias, other)
+
+	_, err = proxycommand.HostKeyAlias("not base64!")
+	require.Error(t, err)
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package route
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/netip"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/validate"
+)
+
+// Advertise opens the WireGuard network and forwards packets addressed to the
+// given destinations out of the host network until interrupted, so that this
+// peer can act as a gateway to them.
+func Advertise(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, destinations []string) error {
+	var prefixes []netip.Prefix
+	for _, destination := range destinations {
+		if err := validate.CIDR(destination); err != nil {
+			return fmt.Errorf("invalid destination: %w", err)
+		}
+
+		prefix := netip.MustParsePrefix(destination).Masked()
+		prefixes = append(prefixes, prefix)
+
+		via := conf.Name
+		if via == "" {
+			via = "<this peer>"
+		}
+
+		logger.Info("Advertising route, peers can use it by running `nsh route add`",
+			slog.String("destination", prefix.String()), slog.String("via", via))
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.Router(logger, network.Host(), prefixes, false, netip.Prefix{}),
+	})
+}
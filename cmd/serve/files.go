@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package serve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// Files shares a directory with the WireGuard network, by serving its
+// contents over HTTP on the listen address. If upload is true, peers can
+// also write files into the directory. Only peers allowed by the access list
+// (if any) can make requests.
+func Files(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	listenAddr, dir string, upload bool, acl *service.AccessList) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path of %q: %w", dir, err)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat directory: %w", err)
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%q is not a directory", dir)
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.FileServer(logger, listenAddr, dir, upload, acl),
+	})
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// HTTP exposes local HTTP servers to the WireGuard network, by reverse
+// proxying requests received on the listen address to the given upstreams.
+// Upstreams are of the form "[path=]url", those without a path are served
+// under the default path. Only peers allowed by the access list (if any) can
+// make requests.
+func HTTP(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	listenAddr string, upstreams []string, defaultPath string, acl *service.AccessList) error {
+	if len(upstreams) == 0 {
+		return errors.New("at least one upstream is required")
+	}
+
+	seen := make(map[string]bool)
+	var parsedUpstreams []service.ReverseProxyUpstream
+	for _, upstream := range upstreams {
+		parsedUpstream, err := ParseUpstream(upstream, defaultPath)
+		if err != nil {
+			return err
+		}
+
+		if seen[parsedUpstream.Path] {
+			return fmt.Errorf("duplicate upstream path %q", parsedUpstream.Path)
+		}
+		seen[parsedUpstream.Path] = true
+
+		parsedUpstreams = append(parsedUpstreams, *parsedUpstream)
+	}
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{
+		service.ReverseProxy(logger, network.Host(), listenAddr, parsedUpstreams, acl),
+	})
+}
+
+// ParseUpstream parses an upstream mapping of the form "[path=]url".
+func ParseUpstream(upstream, defaultPath string) (*service.ReverseProxyUpstream, error) {
+	// URLs can contain '=' (eg. in the query string), so only treat the
+	// upstream as a mapping if it starts with a path.
+	prefix, rawURL, ok := strings.Cut(upstream, "=")
+	if !ok || !strings.HasPrefix(prefix, "/") {
+		prefix, rawURL = defaultPath, upstream
+	}
+
+	if !strings.HasPrefix(prefix, "/") {
+		return nil, fmt.Errorf("invalid upstream %q: path %q must start with '/'", upstream, prefix)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", upstream, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q: expected a http(s) URL", upstream)
+	}
+
+	return &service.ReverseProxyUpstream{
+		Path: path.Clean(prefix),
+		URL:  u,
+	}, nil
+}
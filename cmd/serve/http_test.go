@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package serve_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/serve"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		upstream string
+		path     string
+		url      string
+	}{
+		{"http://127.0.0.1:3000", "/app", "http://127.0.0.1:3000"},
+		{"/api=http://127.0.0.1:8080/v1", "/api", "http://127.0.0.1:8080/v1"},
+		{"/=https://localhost", "/", "https://localhost"},
+		{"/static/=http://localhost:9000", "/static", "http://localhost:9000"},
+		{"http://localhost:3000/?a=b", "/app", "http://localhost:3000/?a=b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.upstream, func(t *testing.T) {
+			upstream, err := serve.ParseUpstream(tt.upstream, "/app")
+			require.NoError(t, err)
+
+			require.Equal(t, tt.path, upstream.Path)
+			require.Equal(t, tt.url, upstream.URL.String())
+		})
+	}
+
+	for _, upstream := range []string{"localhost:3000", "ftp://localhost", "/app=", "app=http://localhost"} {
+		t.Run(upstream, func(t *testing.T) {
+			_, err := serve.ParseUpstream(upstream, "/app")
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package sidecar
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	stdnet "net"
+	"strings"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	forwardcmd "github.com/noisysockets/nsh/cmd/forward"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// Sidecar opens the WireGuard network and forwards connections between the
+// local machine (eg. the pod) and the WireGuard network until interrupted.
+// Inbound mappings forward ports on the WireGuard network to the local
+// machine, and outbound mappings forward local ports to the WireGuard network.
+// Any additional services are run alongside the forwards.
+func Sidecar(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	inbound, outbound []string, services []service.Service) error {
+	if len(inbound) == 0 && len(outbound) == 0 {
+		return errors.New("at least one inbound or outbound mapping is required")
+	}
+
+	for _, mapping := range inbound {
+		svc, err := forwardService(logger, service.ForwardRemote, ExpandInbound(mapping))
+		if err != nil {
+			return err
+		}
+
+		services = append(services, svc)
+	}
+
+	for _, mapping := range outbound {
+		svc, err := forwardService(logger, service.ForwardLocal, ExpandOutbound(mapping))
+		if err != nil {
+			return err
+		}
+
+		services = append(services, svc)
+	}
+
+	return upcmd.Up(ctx, logger, conf, services)
+}
+
+// ExpandInbound expands the shorthand "port[/protocol]" into a mapping that
+// forwards the same port on the WireGuard network to localhost. Any other
+// mapping is returned as is.
+func ExpandInbound(mapping string) string {
+	port, protocol := cutProtocol(mapping)
+	if strings.Contains(port, ":") {
+		return mapping
+	}
+
+	return port + ":localhost:" + port + protocol
+}
+
+// ExpandOutbound expands the shorthand "host:port[/protocol]" into a mapping
+// that forwards the same port on localhost to the host on the WireGuard
+// network. Any other mapping is returned as is.
+func ExpandOutbound(mapping string) string {
+	hostPort, protocol := cutProtocol(mapping)
+
+	host, port, err := stdnet.SplitHostPort(hostPort)
+	if err != nil || service.IsUnixSocket(hostPort) {
+		return mapping
+	}
+
+	return port + ":" + stdnet.JoinHostPort(host, port) + protocol
+}
+
+func forwardService(logger *slog.Logger, direction service.ForwardDirection, mapping string) (service.Service, error) {
+	protocol, listenAddr, dialAddr, err := forwardcmd.ParseMapping(direction, mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.Forward(logger, network.Host(), direction, protocol, listenAddr, dialAddr), nil
+}
+
+// cutProtocol splits any "/tcp" or "/udp" suffix from the mapping.
+func cutProtocol(mapping string) (string, string) {
+	for _, protocol := range []string{"/tcp", "/udp"} {
+		if rest, ok := strings.CutSuffix(mapping, protocol); ok {
+			return rest, protocol
+		}
+	}
+
+	return mapping, ""
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package sidecar_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/nsh/cmd/sidecar"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandInbound(t *testing.T) {
+	tests := []struct {
+		mapping  string
+		expected string
+	}{
+		{"8080", "8080:localhost:8080"},
+		{"5353/udp", "5353:localhost:5353/udp"},
+		{"80:localhost:8080", "80:localhost:8080"},
+		{"2375:/var/run/docker.sock", "2375:/var/run/docker.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			require.Equal(t, tt.expected, sidecar.ExpandInbound(tt.mapping))
+		})
+	}
+}
+
+func TestExpandOutbound(t *testing.T) {
+	tests := []struct {
+		mapping  string
+		expected string
+	}{
+		{"db:5432", "5432:db:5432"},
+		{"[fd00::1]:53/udp", "53:[fd00::1]:53/udp"},
+		{"15432:db:5432", "15432:db:5432"},
+		{"/tmp/db.sock:db:5432", "/tmp/db.sock:db:5432"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mapping, func(t *testing.T) {
+			require.Equal(t, tt.expected, sidecar.ExpandOutbound(tt.mapping))
+		})
+	}
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package status
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	upcmd "github.com/noisysockets/nsh/cmd/up"
+	"github.com/noisysockets/nsh/internal/control"
+	"github.com/noisysockets/nsh/internal/output"
+	"github.com/noisysockets/nsh/internal/service"
+)
+
+// How long to wait for a peer to respond to a ping. This is long enough to
+// allow for a retransmitted handshake (after 5s) if the first is lost.
+const pingTimeout = 10 * time.Second
+
+// PeerStatus is the status of a peer.
+type PeerStatus struct {
+	Name       string   `json:"name,omitempty"`
+	PublicKey  string   `json:"publicKey"`
+	Endpoint   string   `json:"endpoint,omitempty"`
+	AllowedIPs []string `json:"allowedIPs,omitempty"`
+	Reachable  bool     `json:"reachable"`
+	// Latency is the round trip time of a ping to the peer (if reachable).
+	Latency string `json:"latency,omitempty"`
+}
+
+// Status prints the status of each peer, using the running daemon if there
+// is one, otherwise opening the WireGuard network. If interval is non-zero,
+// the status is refreshed every interval until interrupted.
+func Status(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config,
+	socketPath, format string, interval time.Duration) error {
+	if err := output.Validate(format); err != nil {
+		return err
+	}
+
+	s := &statusService{
+		format:   format,
+		interval: interval,
+		w:        os.Stdout,
+	}
+
+	if client, err := control.Dial(socketPath); err == nil {
+		logger.Debug("Using running daemon", slog.String("socket", socketPath))
+
+		ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		return s.run(ctx, func(ctx context.Context) ([]PeerStatus, error) {
+			var peers []PeerStatus
+			err := client.Status(ctx, &peers)
+			return peers, err
+		})
+	}
+
+	s.conf = conf
+
+	return upcmd.Up(ctx, logger, conf, []service.Service{s})
+}
+
+// Peers returns the status of each of the configured peers.
+func Peers(ctx context.Context, net network.Network, conf *latestconfig.Config) []PeerStatus {
+	peers := make([]PeerStatus, len(conf.Peers))
+
+	var wg sync.WaitGroup
+	for i, peerConf := range conf.Peers {
+		peers[i] = PeerStatus{
+			Name:       peerConf.Name,
+			PublicKey:  peerConf.PublicKey,
+			Endpoint:   peerConf.Endpoint,
+			AllowedIPs: allowedIPs(conf, peerConf),
+		}
+
+		if len(peerConf.IPs) == 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+			defer cancel()
+
+			// The first ping may have to wait for a handshake to complete. Try
+			// each of the peers addresses in turn, as we might not share an
+			// address family with the first (eg. in IPv6-only networks).
+			var ip string
+			for _, peerIP := range peerConf.IPs {
+				if err := net.Ping(pingCtx, "ip", peerIP); err == nil {
+					ip = peerIP
+					break
+				}
+			}
+
+			if ip == "" {
+				return
+			}
+
+			peers[i].Reachable = true
+
+			start := time.Now()
+			if err := net.Ping(pingCtx, "ip", ip); err == nil {
+				peers[i].Latency = time.Since(start).Round(time.Microsecond).String()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return peers
+}
+
+var _ service.Service = (*statusService)(nil)
+
+type statusService struct {
+	conf     *latestconfig.Config
+	format   string
+	interval time.Duration
+	w        io.Writer
+}
+
+func (s *statusService) Serve(ctx context.Context, net network.Network) error {
+	return s.run(ctx, func(ctx context.Context) ([]PeerStatus, error) {
+		return Peers(ctx, net, s.conf), nil
+	})
+}
+
+func (s *statusService) run(ctx context.Context, peersFn func(context.Context) ([]PeerStatus, error)) error {
+	for {
+		peers, err := peersFn(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if s.interval > 0 && output.IsHuman(s.format) {
+			// Clear the screen.
+			fmt.Fprint(s.w, "\033[H\033[2J")
+		}
+
+		if err := s.print(peers); err != nil {
+			return err
+		}
+
+		if s.interval == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+func (s *statusService) print(peers []PeerStatus) error {
+	if !output.IsHuman(s.format) {
+		return output.Write(s.w, s.format, peers)
+	}
+
+	w := tabwriter.NewWriter(s.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPUBLIC KEY\tENDPOINT\tALLOWED IPS\tREACHABLE\tLATENCY")
+	for _, peer := range peers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%s\n", peer.Name, peer.PublicKey, peer.Endpoint,
+			strings.Join(peer.AllowedIPs, ","), peer.Reachable, peer.Latency)
+	}
+	return w.Flush()
+}
+
+// allowedIPs returns the addresses assigned to the peer, and the destinations
+// of any routes via the peer.
+func allowedIPs(conf *latestconfig.Config, peerConf latestconfig.PeerConfig) []string {
+	ips := append([]string{}, peerConf.IPs...)
+
+	for _, routeConf := range conf.Routes {
+		if routeConf.Via == peerConf.PublicKey || (peerConf.Name != "" && routeConf.Via == peerConf.Name) {
+			ips = append(ips, routeConf.Destination)
+		}
+	}
+
+	return ips
+}
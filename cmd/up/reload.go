@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"reflect"
+	"slices"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+)
+
+// ConfigLoader loads the current contents of the configuration file.
+type ConfigLoader func() (*latestconfig.Config, error)
+
+type configLoaderKey struct{}
+
+// WithConfigLoader returns a context that allows Up to reload the
+// configuration, using the given loader, when a SIGHUP is received.
+func WithConfigLoader(ctx context.Context, loader ConfigLoader) context.Context {
+	return context.WithValue(ctx, configLoaderKey{}, loader)
+}
+
+// WithConfigOverride returns a context whose config loader (if any) applies
+// override to every reloaded configuration, so that command line flags which
+// override the configuration file stay in effect.
+func WithConfigOverride(ctx context.Context, override func(conf *latestconfig.Config)) context.Context {
+	loader, ok := configLoaderFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	return WithConfigLoader(ctx, func() (*latestconfig.Config, error) {
+		conf, err := loader()
+		if err != nil {
+			return nil, err
+		}
+
+		override(conf)
+
+		return conf, nil
+	})
+}
+
+func configLoaderFromContext(ctx context.Context) (ConfigLoader, bool) {
+	loader, ok := ctx.Value(configLoaderKey{}).(ConfigLoader)
+	return loader, ok
+}
+
+// reloadPeers applies any changes to the set of peers (and routes) in newConf
+// to the open network. Peers that have not changed are left as is, so
+// existing connections through them are not interrupted. The peers and
+// routes of conf are replaced.
+func reloadPeers(logger *slog.Logger, net *noisysockets.NoisySocketsNetwork, conf, newConf *latestconfig.Config) error {
+	if !reflect.DeepEqual(withoutPeersAndRoutes(conf), withoutPeersAndRoutes(newConf)) {
+		logger.Warn("Configuration changes other than peers and routes require a restart to take effect")
+	}
+
+	removed, added := DiffPeers(conf.Peers, newConf.Peers)
+	removedRoutes, addedRoutes := diffRoutes(conf.Routes, newConf.Routes)
+
+	for _, peerConf := range removed {
+		var publicKey types.NoisePublicKey
+		if err := publicKey.UnmarshalText([]byte(peerConf.PublicKey)); err != nil {
+			return fmt.Errorf("failed to parse public key of peer %q: %w", peerConf.Name, err)
+		}
+
+		logger.Info("Removing peer", slog.String("name", peerConf.Name), slog.String("publicKey", peerConf.PublicKey))
+
+		net.RemovePeer(publicKey)
+	}
+
+	for _, routeConf := range removedRoutes {
+		destination, err := netip.ParsePrefix(routeConf.Destination)
+		if err != nil {
+			continue
+		}
+
+		logger.Info("Removing route", slog.String("destination", routeConf.Destination), slog.String("via", routeConf.Via))
+
+		// The gateway (and its routes) may have already been removed.
+		if err := net.RemoveRoute(destination); err != nil && !errors.Is(err, noisysockets.ErrUnknownPeer) {
+			logger.Warn("Failed to remove route", slog.String("destination", routeConf.Destination), slog.Any("error", err))
+		}
+	}
+
+	var errs []error
+	for _, peerConf := range added {
+		logger.Info("Adding peer", slog.String("name", peerConf.Name), slog.String("publicKey", peerConf.PublicKey))
+
+		if err := net.AddPeer(peerConf); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add peer %q: %w", peerConf.Name, err))
+			continue
+		}
+
+		// Any existing routes via the peer were removed along with it.
+		var routes []latestconfig.RouteConfig
+		for _, routeConf := range newConf.Routes {
+			if !slices.Contains(addedRoutes, routeConf) {
+				routes = append(routes, routeConf)
+			}
+		}
+
+		if err := addRoutesVia(net, routes, peerConf); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, routeConf := range addedRoutes {
+		logger.Info("Adding route", slog.String("destination", routeConf.Destination), slog.String("via", routeConf.Via))
+
+		if err := net.AddRoute(routeConf); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add route to %s: %w", routeConf.Destination, err))
+		}
+	}
+
+	conf.Peers = newConf.Peers
+	conf.Routes = newConf.Routes
+
+	return errors.Join(errs...)
+}
+
+// diffRoutes returns the routes that are no longer present (or have changed)
+// in newRoutes, and those that are new (or have changed).
+func diffRoutes(routes, newRoutes []latestconfig.RouteConfig) (removed, added []latestconfig.RouteConfig) {
+	for _, routeConf := range routes {
+		if !slices.Contains(newRoutes, routeConf) {
+			removed = append(removed, routeConf)
+		}
+	}
+
+	for _, routeConf := range newRoutes {
+		if !slices.Contains(routes, routeConf) {
+			added = append(added, routeConf)
+		}
+	}
+
+	return removed, added
+}
+
+// DiffPeers returns the peers that are no longer present (or have changed)
+// in newPeers, and those that are new (or have changed). Peers are
+// identified by their public key.
+func DiffPeers(peers, newPeers []latestconfig.PeerConfig) (removed, added []latestconfig.PeerConfig) {
+	byPublicKey := make(map[string]latestconfig.PeerConfig, len(peers))
+	for _, peerConf := range peers {
+		byPublicKey[peerConf.PublicKey] = peerConf
+	}
+
+	newByPublicKey := make(map[string]latestconfig.PeerConfig, len(newPeers))
+	for _, peerConf := range newPeers {
+		newByPublicKey[peerConf.PublicKey] = peerConf
+	}
+
+	for _, peerConf := range peers {
+		newPeerConf, ok := newByPublicKey[peerConf.PublicKey]
+		if !ok || !peerEqual(peerConf, newPeerConf) {
+			removed = append(removed, peerConf)
+		}
+	}
+
+	for _, peerConf := range newPeers {
+		oldPeerConf, ok := byPublicKey[peerConf.PublicKey]
+		if !ok || !peerEqual(oldPeerConf, peerConf) {
+			added = append(added, peerConf)
+		}
+	}
+
+	return removed, added
+}
+
+func peerEqual(a, b latestconfig.PeerConfig) bool {
+	return a.Name == b.Name && a.PublicKey == b.PublicKey &&
+		a.Endpoint == b.Endpoint && slices.Equal(a.IPs, b.IPs)
+}
+
+func withoutPeersAndRoutes(conf *latestconfig.Config) latestconfig.Config {
+	c := *conf
+	c.Peers = nil
+	c.Routes = nil
+	return c
+}
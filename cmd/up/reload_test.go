@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up_test
+
+import (
+	"testing"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/nsh/cmd/up"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPeers(t *testing.T) {
+	unchanged := latestconfig.PeerConfig{Name: "peer1", PublicKey: "key1", IPs: []string{"100.64.0.1"}}
+	removed := latestconfig.PeerConfig{Name: "peer2", PublicKey: "key2", IPs: []string{"100.64.0.2"}}
+	changed := latestconfig.PeerConfig{Name: "peer3", PublicKey: "key3", IPs: []string{"100.64.0.3"}}
+	updated := latestconfig.PeerConfig{Name: "peer3", PublicKey: "key3", Endpoint: "peer3.example.com:51820", IPs: []string{"100.64.0.3"}}
+	added := latestconfig.PeerConfig{Name: "peer4", PublicKey: "key4", IPs: []string{"100.64.0.4"}}
+
+	gotRemoved, gotAdded := up.DiffPeers(
+		[]latestconfig.PeerConfig{unchanged, removed, changed},
+		[]latestconfig.PeerConfig{unchanged, updated, added},
+	)
+
+	require.Equal(t, []latestconfig.PeerConfig{removed, changed}, gotRemoved)
+	require.Equal(t, []latestconfig.PeerConfig{updated, added}, gotAdded)
+}
@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	stdnet "net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/util"
+)
+
+// How long to wait when resolving a peer endpoint.
+const resolveTimeout = 10 * time.Second
+
+type resolveIntervalKey struct{}
+
+// WithResolveInterval returns a context that makes Up periodically re-resolve
+// the hostnames of peer endpoints, so that peers with dynamic IP addresses
+// can still be reached after their address changes. An interval of 0
+// disables re-resolution.
+func WithResolveInterval(ctx context.Context, interval time.Duration) context.Context {
+	return context.WithValue(ctx, resolveIntervalKey{}, interval)
+}
+
+func resolveIntervalFromContext(ctx context.Context) time.Duration {
+	interval, _ := ctx.Value(resolveIntervalKey{}).(time.Duration)
+	return interval
+}
+
+type lookupHostFunc func(ctx context.Context, host string) ([]string, error)
+
+// endpointResolver keeps track of the addresses peer endpoint hostnames
+// resolved to, so that peers can be updated when they change.
+type endpointResolver struct {
+	logger     *slog.Logger
+	net        *noisysockets.NoisySocketsNetwork
+	conf       *latestconfig.Config
+	mu         *sync.Mutex
+	lookupHost lookupHostFunc
+	// addrs is the last address each peer's endpoint resolved to, by public
+	// key and endpoint.
+	addrs map[string]string
+}
+
+func newEndpointResolver(logger *slog.Logger, net *noisysockets.NoisySocketsNetwork,
+	conf *latestconfig.Config, mu *sync.Mutex) *endpointResolver {
+	return &endpointResolver{
+		logger:     logger,
+		net:        net,
+		conf:       conf,
+		mu:         mu,
+		lookupHost: stdnet.DefaultResolver.LookupHost,
+		addrs:      make(map[string]string),
+	}
+}
+
+// run re-resolves peer endpoints at (jittered) intervals until the context
+// is cancelled.
+func (r *endpointResolver) run(ctx context.Context, interval time.Duration) error {
+	// Record what the endpoints resolved to when the network was opened.
+	r.resolve(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(jitter(interval)):
+			r.resolve(ctx)
+		}
+	}
+}
+
+// resolve looks up the endpoint of every peer that uses a hostname, and
+// re-adds any peers whose endpoint address has changed.
+func (r *endpointResolver) resolve(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, peerConf := range r.conf.Peers {
+		host, _, err := stdnet.SplitHostPort(peerConf.Endpoint)
+		if err != nil {
+			continue
+		}
+
+		// Nothing to resolve.
+		if _, err := netip.ParseAddr(host); err == nil {
+			continue
+		}
+
+		lookupCtx, cancel := context.WithTimeout(ctx, resolveTimeout)
+		addrs, err := r.lookupHost(lookupCtx, host)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			r.logger.Warn("Failed to resolve peer endpoint",
+				slog.String("name", peerConf.Name), slog.String("endpoint", peerConf.Endpoint), slog.Any("error", err))
+			continue
+		}
+
+		// Hostnames with several addresses (eg. round robin DNS) are only
+		// updated if the address in use is no longer one of them.
+		key := peerConf.PublicKey + "/" + peerConf.Endpoint
+		lastAddr, ok := r.addrs[key]
+		if ok && slices.Contains(addrs, lastAddr) {
+			continue
+		}
+
+		r.addrs[key] = addrs[0]
+
+		// The first time around, the endpoint has only just been resolved.
+		if !ok {
+			continue
+		}
+
+		r.logger.Info("Peer endpoint address changed",
+			slog.String("name", peerConf.Name), slog.String("endpoint", peerConf.Endpoint),
+			slog.String("oldAddr", lastAddr), slog.String("newAddr", addrs[0]))
+
+		if err := r.updatePeer(peerConf); err != nil {
+			r.logger.Warn("Failed to update peer endpoint", slog.String("name", peerConf.Name), slog.Any("error", err))
+		}
+	}
+}
+
+// updatePeer re-adds the peer (and any routes via it), so that its endpoint
+// is resolved again.
+func (r *endpointResolver) updatePeer(peerConf latestconfig.PeerConfig) error {
+	var publicKey types.NoisePublicKey
+	if err := publicKey.UnmarshalText([]byte(peerConf.PublicKey)); err != nil {
+		return fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	r.net.RemovePeer(publicKey)
+
+	if err := r.net.AddPeer(peerConf); err != nil {
+		return err
+	}
+
+	return addRoutesVia(r.net, r.conf.Routes, peerConf)
+}
+
+// jitter returns the interval randomly adjusted by up to +/-10%, so that a
+// fleet of peers don't all query DNS at the same time.
+func jitter(interval time.Duration) time.Duration {
+	spread := int(interval / 10)
+	if spread <= 0 {
+		return interval
+	}
+
+	return interval + time.Duration(util.RandomInt(-spread, spread+1))
+}
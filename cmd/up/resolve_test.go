@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpointResolver(t *testing.T) {
+	privateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	peerPrivateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	conf := &latestconfig.Config{
+		PrivateKey: privateKey.String(),
+		IPs:        []string{"100.64.0.1"},
+		Peers: []latestconfig.PeerConfig{
+			{
+				Name:      "static",
+				PublicKey: peerPrivateKey.Public().String(),
+				Endpoint:  "127.0.0.1:51820",
+				IPs:       []string{"100.64.0.2"},
+			},
+		},
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	net, err := noisysockets.OpenNetwork(logger, conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, net.Close())
+	})
+
+	dynamicPrivateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	// Added after the network is opened, as the real lookup is used by AddPeer.
+	dynamic := latestconfig.PeerConfig{
+		Name:      "dynamic",
+		PublicKey: dynamicPrivateKey.Public().String(),
+		Endpoint:  "localhost:51820",
+		IPs:       []string{"100.64.0.3"},
+	}
+	require.NoError(t, net.AddPeer(dynamic))
+	conf.Peers = append(conf.Peers, dynamic)
+
+	var lookups int
+	addrs := []string{"192.0.2.1", "192.0.2.2"}
+
+	r := newEndpointResolver(logger, net, conf, &sync.Mutex{})
+	r.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		require.Equal(t, "localhost", host)
+		lookups++
+		return addrs, nil
+	}
+
+	ctx := context.Background()
+
+	r.resolve(ctx)
+	require.Equal(t, 1, lookups)
+	require.NotContains(t, logs.String(), "Peer endpoint address changed")
+
+	// Round robin DNS, the address in use is still valid.
+	addrs = []string{"192.0.2.2", "192.0.2.1"}
+	r.resolve(ctx)
+	require.NotContains(t, logs.String(), "Peer endpoint address changed")
+
+	addrs = []string{"192.0.2.3"}
+	r.resolve(ctx)
+	require.Contains(t, logs.String(), "Peer endpoint address changed")
+	require.NotContains(t, logs.String(), "Failed to update peer endpoint")
+	require.Equal(t, 3, lookups)
+}
+
+func TestEndpointResolverRoutes(t *testing.T) {
+	privateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	conf := &latestconfig.Config{
+		PrivateKey: privateKey.String(),
+		IPs:        []string{"100.64.0.1"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	net, err := noisysockets.OpenNetwork(logger, conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, net.Close())
+	})
+
+	gatewayPrivateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	gateway := latestconfig.PeerConfig{
+		Name:      "gateway",
+		PublicKey: gatewayPrivateKey.Public().String(),
+		Endpoint:  "localhost:51820",
+		IPs:       []string{"100.64.0.2"},
+	}
+	route := latestconfig.RouteConfig{
+		Destination: "10.0.0.0/8",
+		Via:         "gateway",
+	}
+
+	require.NoError(t, net.AddPeer(gateway))
+	require.NoError(t, net.AddRoute(route))
+	conf.Peers = append(conf.Peers, gateway)
+	conf.Routes = append(conf.Routes, route)
+
+	addrs := []string{"192.0.2.1"}
+
+	r := newEndpointResolver(logger, net, conf, &sync.Mutex{})
+	r.lookupHost = func(_ context.Context, _ string) ([]string, error) {
+		return addrs, nil
+	}
+
+	ctx := context.Background()
+
+	r.resolve(ctx)
+
+	addrs = []string{"192.0.2.2"}
+	r.resolve(ctx)
+
+	// Removing the route fails if no peer has it.
+	require.NoError(t, net.RemoveRoute(netip.MustParsePrefix(route.Destination)))
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Minute)
+		require.GreaterOrEqual(t, d, 54*time.Second)
+		require.LessOrEqual(t, d, 66*time.Second)
+	}
+
+	require.Equal(t, time.Duration(0), jitter(0))
+}
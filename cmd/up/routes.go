@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+)
+
+// addRoutesVia adds the routes that use the peer as their gateway. Routes
+// are added to the allowed IPs of the gateway peer, so they are lost when
+// the peer is removed, and need to be added again along with it.
+func addRoutesVia(net *noisysockets.NoisySocketsNetwork, routes []latestconfig.RouteConfig, peerConf latestconfig.PeerConfig) error {
+	var errs []error
+	for _, routeConf := range routes {
+		if !isRouteVia(routeConf, peerConf) {
+			continue
+		}
+
+		if err := net.AddRoute(routeConf); err != nil {
+			errs = append(errs, fmt.Errorf("failed to add route to %s: %w", routeConf.Destination, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isRouteVia(routeConf latestconfig.RouteConfig, peerConf latestconfig.PeerConfig) bool {
+	return routeConf.Via == peerConf.PublicKey || (peerConf.Name != "" && routeConf.Via == peerConf.Name)
+}
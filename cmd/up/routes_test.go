@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadPeersRoutes(t *testing.T) {
+	privateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	gatewayPrivateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	gateway := latestconfig.PeerConfig{
+		Name:      "gateway",
+		PublicKey: gatewayPrivateKey.Public().String(),
+		IPs:       []string{"100.64.0.2"},
+	}
+
+	kept := latestconfig.RouteConfig{Destination: "10.0.0.0/8", Via: "gateway"}
+	removed := latestconfig.RouteConfig{Destination: "192.168.0.0/16", Via: "gateway"}
+	added := latestconfig.RouteConfig{Destination: "172.16.0.0/12", Via: "gateway"}
+
+	conf := &latestconfig.Config{
+		PrivateKey: privateKey.String(),
+		IPs:        []string{"100.64.0.1"},
+		Peers:      []latestconfig.PeerConfig{gateway},
+		Routes:     []latestconfig.RouteConfig{kept, removed},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	net, err := noisysockets.OpenNetwork(logger, conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, net.Close())
+	})
+
+	hasRoute := func(routeConf latestconfig.RouteConfig) bool {
+		// Removing a route fails if no peer has it, so add it back afterwards.
+		if err := net.RemoveRoute(netip.MustParsePrefix(routeConf.Destination)); err != nil {
+			require.ErrorIs(t, err, noisysockets.ErrUnknownPeer)
+			return false
+		}
+
+		require.NoError(t, net.AddRoute(routeConf))
+		return true
+	}
+
+	t.Run("Routes Changed", func(t *testing.T) {
+		newConf := *conf
+		newConf.Routes = []latestconfig.RouteConfig{kept, added}
+
+		require.NoError(t, reloadPeers(logger, net, conf, &newConf))
+		require.Equal(t, newConf.Routes, conf.Routes)
+
+		require.True(t, hasRoute(kept))
+		require.True(t, hasRoute(added))
+		require.False(t, hasRoute(removed))
+	})
+
+	t.Run("Gateway Changed", func(t *testing.T) {
+		// The gateway will be removed and added again.
+		updatedGateway := gateway
+		updatedGateway.Endpoint = "127.0.0.1:51820"
+
+		newConf := *conf
+		newConf.Peers = []latestconfig.PeerConfig{updatedGateway}
+
+		require.NoError(t, reloadPeers(logger, net, conf, &newConf))
+
+		require.True(t, hasRoute(kept))
+		require.True(t, hasRoute(added))
+	})
+}
@@ -14,17 +14,37 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	stdnet "net"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/noisysockets/noisysockets"
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
 	"github.com/noisysockets/nsh/internal/service"
+	"github.com/noisysockets/nsh/internal/util"
 	"golang.org/x/sync/errgroup"
 )
 
 func Up(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, services []service.Service) error {
+	// Check the port is free up front, so we can return a more helpful error.
+	if conf.ListenPort != 0 {
+		pc, err := stdnet.ListenPacket("udp", fmt.Sprintf(":%d", conf.ListenPort))
+		if err != nil {
+			return fmt.Errorf("WireGuard listen port %d is not available: %w", conf.ListenPort, err)
+		}
+		_ = pc.Close()
+	}
+
+	if conf.DNS != nil {
+		logger.Debug("Using DNS configuration",
+			slog.String("domain", conf.DNS.Domain),
+			slog.String("protocol", string(conf.DNS.Protocol)),
+			slog.Any("servers", conf.DNS.Servers))
+	}
+
 	logger.Debug("Opening WireGuard network")
 
 	net, err := noisysockets.OpenNetwork(logger, conf)
@@ -33,6 +53,12 @@ func Up(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, ser
 	}
 	defer net.Close()
 
+	logger.Debug("WireGuard network opened", slog.Int("listenPort", int(net.ListenPort())))
+
+	if err := util.SdNotify(util.SdNotifyReady); err != nil {
+		logger.Warn("Failed to notify systemd", slog.Any("error", err))
+	}
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	// Capture the signal to close the listener
@@ -45,19 +71,98 @@ func Up(ctx context.Context, logger *slog.Logger, conf *latestconfig.Config, ser
 			return ctx.Err()
 		case <-sig:
 			logger.Debug("Received signal, shutting down")
+
+			if err := util.SdNotify(util.SdNotifyStopping); err != nil {
+				logger.Warn("Failed to notify systemd", slog.Any("error", err))
+			}
+
 			return context.Canceled
 		}
 	})
 
+	// Guards the set of peers, which may be reloaded or updated concurrently.
+	peers := &peerManager{net: net}
+
+	// Keep peers with dynamic endpoint addresses reachable.
+	if interval := resolveIntervalFromContext(ctx); interval > 0 {
+		r := newEndpointResolver(logger, net, conf, &peers.Mutex)
+		g.Go(func() error {
+			return r.run(ctx, interval)
+		})
+	}
+
+	// Reload the set of peers when asked to.
+	if loader, ok := configLoaderFromContext(ctx); ok {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+
+		g.Go(func() error {
+			defer signal.Stop(hup)
+
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-hup:
+					logger.Info("Received SIGHUP, reloading configuration")
+
+					peers.Lock()
+					if err := reload(logger, net, conf, loader); err != nil {
+						logger.Warn("Failed to reload configuration", slog.Any("error", err))
+					}
+					peers.Unlock()
+				}
+			}
+		})
+	}
+
+	// Services that add peers (eg. the directory) share the lock.
+	serviceCtx := service.WithPeerManager(ctx, peers)
+
+	var wg sync.WaitGroup
 	for _, s := range services {
+		wg.Add(1)
 		g.Go(func() error {
-			return s.Serve(ctx, net)
+			defer wg.Done()
+
+			return s.Serve(serviceCtx, net)
 		})
 	}
 
+	// Shutdown once all of the services have completed.
+	g.Go(func() error {
+		wg.Wait()
+		return context.Canceled
+	})
+
 	if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
 		return err
 	}
 
 	return nil
 }
+
+func reload(logger *slog.Logger, net *noisysockets.NoisySocketsNetwork, conf *latestconfig.Config, loader ConfigLoader) error {
+	newConf, err := loader()
+	if err != nil {
+		return err
+	}
+
+	return reloadPeers(logger, net, conf, newConf)
+}
+
+var _ service.PeerManager = (*peerManager)(nil)
+
+// peerManager serialises changes to the set of peers of the network.
+type peerManager struct {
+	sync.Mutex
+	net *noisysockets.NoisySocketsNetwork
+}
+
+func (pm *peerManager) AddPeer(peerConf latestconfig.PeerConfig) error {
+	return pm.net.AddPeer(peerConf)
+}
+
+func (pm *peerManager) RemovePeer(publicKey types.NoisePublicKey) {
+	pm.net.RemovePeer(publicKey)
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package up
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/noisysockets"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadConfigOverride(t *testing.T) {
+	privateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	peerPrivateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	peer := latestconfig.PeerConfig{
+		Name:      "peer1",
+		PublicKey: peerPrivateKey.Public().String(),
+		IPs:       []string{"100.64.0.2"},
+	}
+
+	// The configuration file, before any overrides.
+	load := func() (*latestconfig.Config, error) {
+		return &latestconfig.Config{
+			ListenPort: 51820,
+			PrivateKey: privateKey.String(),
+			IPs:        []string{"100.64.0.1"},
+			DNS:        &latestconfig.DNSConfig{Servers: []string{"100.64.0.2"}},
+			Peers:      []latestconfig.PeerConfig{peer},
+		}, nil
+	}
+
+	override := func(conf *latestconfig.Config) {
+		conf.ListenPort = 0
+		conf.DNS.Servers = []string{"1.1.1.1:53"}
+	}
+
+	ctx := WithConfigOverride(WithConfigLoader(context.Background(), load), override)
+
+	loader, ok := configLoaderFromContext(ctx)
+	require.True(t, ok)
+
+	conf, err := load()
+	require.NoError(t, err)
+	override(conf)
+
+	net, err := noisysockets.OpenNetwork(slog.New(slog.NewTextHandler(io.Discard, nil)), conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, net.Close())
+	})
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	require.NoError(t, reload(logger, net, conf, loader))
+	require.NotContains(t, logs.String(), "require a restart")
+
+	require.Equal(t, uint16(0), conf.ListenPort)
+	require.Equal(t, []string{"1.1.1.1:53"}, conf.DNS.Servers)
+}
@@ -0,0 +1,425 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/noisysockets/nsh/internal/constants"
+	"github.com/noisysockets/nsh/internal/util"
+	"golang.org/x/mod/semver"
+)
+
+// Release channels.
+const (
+	// ChannelStable only includes full releases.
+	ChannelStable = "stable"
+	// ChannelPrerelease also includes release candidates etc.
+	ChannelPrerelease = "prerelease"
+)
+
+const (
+	releasesURL = "https://api.github.com/repos/noisysockets/nsh/releases?per_page=100"
+	// The name of the release asset listing the SHA-256 checksum of each binary.
+	checksumsAsset = "checksums.txt"
+	// How long to wait for the release feed.
+	feedTimeout = 30 * time.Second
+	// The largest release feed or checksums file we're willing to download.
+	maxMetadataSize = 10 * 1024 * 1024
+	// The largest binary we're willing to download.
+	maxBinarySize = 256 * 1024 * 1024
+)
+
+// Options configures an update.
+type Options struct {
+	// Channel is the release channel to update from.
+	Channel string
+	// CheckOnly reports whether an update is available, without installing it.
+	CheckOnly bool
+	// PublicKey is the minisign public key used to verify the signature of
+	// the release checksums. If empty, the key embedded at build time is used.
+	PublicKey string
+	// Insecure allows updating without a public key, only verifying the
+	// release checksums.
+	Insecure bool
+}
+
+// Update replaces the running nsh binary with the latest release from the
+// selected channel. The downloaded binary is verified against the release
+// checksums, which are themselves verified against their minisign signature
+// if a public key is available.
+func Update(ctx context.Context, logger *slog.Logger, w io.Writer, opts *Options) error {
+	exePath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	exePath, err = filepath.EvalSymlinks(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve executable path: %w", err)
+	}
+
+	publicKey := opts.PublicKey
+	if publicKey == "" {
+		publicKey = constants.ReleasePublicKey
+	}
+
+	u := &updater{
+		logger:         logger,
+		w:              w,
+		releasesURL:    releasesURL,
+		assetName:      assetName(runtime.GOOS, runtime.GOARCH),
+		exePath:        exePath,
+		currentVersion: constants.Version,
+		publicKey:      publicKey,
+		insecure:       opts.Insecure,
+	}
+
+	return u.update(ctx, opts.Channel, opts.CheckOnly)
+}
+
+type release struct {
+	TagName    string         `json:"tag_name"`
+	Draft      bool           `json:"draft"`
+	Prerelease bool           `json:"prerelease"`
+	Assets     []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+type updater struct {
+	logger         *slog.Logger
+	w              io.Writer
+	releasesURL    string
+	assetName      string
+	exePath        string
+	currentVersion string
+	publicKey      string
+	insecure       bool
+}
+
+func (u *updater) update(ctx context.Context, channel string, checkOnly bool) error {
+	if channel != ChannelStable && channel != ChannelPrerelease {
+		return fmt.Errorf("unsupported release channel %q, expected one of: %s, %s",
+			channel, ChannelStable, ChannelPrerelease)
+	}
+
+	latest, err := u.latestRelease(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	isDevBuild := !semver.IsValid(u.currentVersion)
+
+	if checkOnly {
+		if isDevBuild || semver.Compare(latest.TagName, u.currentVersion) > 0 {
+			_, err := fmt.Fprintf(u.w, "A new version of nsh is available: %s (current %s)\n", latest.TagName, u.currentVersion)
+			return err
+		}
+
+		_, err := fmt.Fprintf(u.w, "nsh is up to date (%s)\n", u.currentVersion)
+		return err
+	}
+
+	if isDevBuild {
+		return fmt.Errorf("development builds (%s) can't be updated, install a release instead", u.currentVersion)
+	}
+
+	if semver.Compare(latest.TagName, u.currentVersion) <= 0 {
+		_, err := fmt.Fprintf(u.w, "nsh is up to date (%s)\n", u.currentVersion)
+		return err
+	}
+
+	if u.publicKey == "" {
+		// The checksums alone only protect against corrupted downloads.
+		if !u.insecure {
+			return errors.New("no release public key available to verify the update, provide one with --public-key (or use --insecure to only verify checksums)")
+		}
+
+		u.logger.Warn("No release public key available, only verifying checksums")
+	}
+
+	u.logger.Info("Downloading release", slog.String("version", latest.TagName), slog.String("asset", u.assetName))
+
+	checksum, err := u.expectedChecksum(ctx, latest)
+	if err != nil {
+		return err
+	}
+
+	binaryURL, ok := latest.assetURL(u.assetName)
+	if !ok {
+		return fmt.Errorf("release %s has no binary for this platform (%s)", latest.TagName, u.assetName)
+	}
+
+	if err := u.install(ctx, binaryURL, checksum); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(u.w, "Updated nsh from %s to %s\n", u.currentVersion, latest.TagName)
+	return err
+}
+
+// latestRelease returns the newest release in the channel.
+func (u *updater) latestRelease(ctx context.Context, channel string) (*release, error) {
+	ctx, cancel := context.WithTimeout(ctx, feedTimeout)
+	defer cancel()
+
+	data, err := u.fetch(ctx, u.releasesURL, maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch releases: %w", err)
+	}
+
+	var releases []release
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("failed to parse releases: %w", err)
+	}
+
+	var latest *release
+	for i := range releases {
+		r := &releases[i]
+		if r.Draft || !semver.IsValid(r.TagName) {
+			continue
+		}
+
+		if r.Prerelease && channel != ChannelPrerelease {
+			continue
+		}
+
+		if latest == nil || semver.Compare(r.TagName, latest.TagName) > 0 {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return nil, fmt.Errorf("no %s releases found", channel)
+	}
+
+	return latest, nil
+}
+
+// expectedChecksum returns the SHA-256 checksum of the binary for this
+// platform, as listed in the (verified) release checksums.
+func (u *updater) expectedChecksum(ctx context.Context, r *release) ([]byte, error) {
+	checksumsURL, ok := r.assetURL(checksumsAsset)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no %s", r.TagName, checksumsAsset)
+	}
+
+	checksums, err := u.fetch(ctx, checksumsURL, maxMetadataSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch checksums: %w", err)
+	}
+
+	if u.publicKey != "" {
+		sigURL, ok := r.assetURL(checksumsAsset + ".minisig")
+		if !ok {
+			return nil, fmt.Errorf("release %s is not signed", r.TagName)
+		}
+
+		sig, err := u.fetch(ctx, sigURL, maxMetadataSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch checksums signature: %w", err)
+		}
+
+		if err := util.VerifyMinisign(u.publicKey, checksums, sig); err != nil {
+			return nil, fmt.Errorf("invalid checksums signature: %w", err)
+		}
+	}
+
+	return parseChecksum(checksums, u.assetName)
+}
+
+// install downloads the binary alongside the current executable, verifies
+// its checksum, and then atomically renames it over the current executable.
+func (u *updater) install(ctx context.Context, binaryURL string, checksum []byte) error {
+	dir := filepath.Dir(u.exePath)
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(u.exePath)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := f.Name()
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	body, err := u.open(ctx, binaryURL)
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(body, maxBinarySize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download binary: %w", err)
+	}
+
+	if n > maxBinarySize {
+		return errors.New("downloaded binary is too large")
+	}
+
+	if sum := h.Sum(nil); !bytes.Equal(sum, checksum) {
+		return fmt.Errorf("checksum mismatch, expected %x but got %x", checksum, sum)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write binary: %w", err)
+	}
+
+	// Keep the permissions of the existing binary.
+	fi, err := os.Stat(u.exePath)
+	if err != nil {
+		return fmt.Errorf("failed to stat executable: %w", err)
+	}
+
+	if err := os.Chmod(tmpPath, fi.Mode().Perm()|0o111); err != nil {
+		return fmt.Errorf("failed to set binary permissions: %w", err)
+	}
+
+	return replace(tmpPath, u.exePath)
+}
+
+// replace renames the new binary over the old one.
+func replace(newPath, exePath string) error {
+	// Windows won't let us overwrite a running executable, but it can be
+	// renamed out of the way.
+	if runtime.GOOS == "windows" {
+		oldPath := exePath + ".old"
+		_ = os.Remove(oldPath)
+
+		if err := os.Rename(exePath, oldPath); err != nil {
+			return fmt.Errorf("failed to move executable: %w", err)
+		}
+
+		if err := os.Rename(newPath, exePath); err != nil {
+			_ = os.Rename(oldPath, exePath)
+			return fmt.Errorf("failed to replace executable: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := os.Rename(newPath, exePath); err != nil {
+		return fmt.Errorf("failed to replace executable: %w", err)
+	}
+
+	return nil
+}
+
+func (u *updater) fetch(ctx context.Context, url string, maxSize int64) ([]byte, error) {
+	body, err := u.open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%s is too large", url)
+	}
+
+	return data, nil
+}
+
+func (u *updater) open(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub requires a user agent.
+	req.Header.Set("User-Agent", "nsh/"+u.currentVersion)
+	req.Header.Set("Accept", "application/vnd.github+json, application/octet-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func (r *release) assetURL(name string) (string, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.DownloadURL, true
+		}
+	}
+
+	return "", false
+}
+
+// parseChecksum returns the checksum of the named file from sha256sum output.
+func parseChecksum(checksums []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		// Binary mode files are prefixed with '*'.
+		file := strings.TrimPrefix(strings.TrimPrefix(fields[1], "*"), "./")
+		if file != name {
+			continue
+		}
+
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("invalid checksum for %s", name)
+		}
+
+		return sum, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checksums: %w", err)
+	}
+
+	return nil, fmt.Errorf("no checksum found for %s", name)
+}
+
+func assetName(goos, goarch string) string {
+	name := "nsh-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate(t *testing.T) {
+	publicKey, privateKey, keyID := generateMinisignKey(t)
+
+	binary := []byte("#!/bin/sh\necho v0.2.0\n")
+	sum := sha256.Sum256(binary)
+	checksums := []byte(fmt.Sprintf("%x  ./nsh-linux-amd64\n%x  ./nsh-darwin-arm64\n", sum, sha256.Sum256(nil)))
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases":
+			asset := func(tag, name string) releaseAsset {
+				return releaseAsset{Name: name, DownloadURL: srv.URL + "/download/" + tag + "/" + name}
+			}
+
+			_ = json.NewEncoder(w).Encode([]release{
+				{TagName: "v0.3.0-rc.1", Prerelease: true},
+				{TagName: "v0.2.0", Assets: []releaseAsset{
+					asset("v0.2.0", "nsh-linux-amd64"),
+					asset("v0.2.0", "checksums.txt"),
+					asset("v0.2.0", "checksums.txt.minisig"),
+				}},
+				{TagName: "v0.1.0"},
+				{TagName: "v0.4.0", Draft: true},
+			})
+		case "/download/v0.2.0/nsh-linux-amd64":
+			_, _ = w.Write(binary)
+		case "/download/v0.2.0/checksums.txt":
+			_, _ = w.Write(checksums)
+		case "/download/v0.2.0/checksums.txt.minisig":
+			_, _ = w.Write(minisign(privateKey, keyID, checksums))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	newUpdater := func(t *testing.T, currentVersion, publicKey string) (*updater, *strings.Builder) {
+		exePath := filepath.Join(t.TempDir(), "nsh")
+		require.NoError(t, os.WriteFile(exePath, []byte("old"), 0o755))
+
+		var out strings.Builder
+		return &updater{
+			logger:         slog.Default(),
+			w:              &out,
+			releasesURL:    srv.URL + "/releases",
+			assetName:      "nsh-linux-amd64",
+			exePath:        exePath,
+			currentVersion: currentVersion,
+			publicKey:      publicKey,
+		}, &out
+	}
+
+	ctx := context.Background()
+
+	t.Run("Check Only", func(t *testing.T) {
+		u, out := newUpdater(t, "v0.1.0", publicKey)
+
+		require.NoError(t, u.update(ctx, ChannelStable, true))
+		require.Equal(t, "A new version of nsh is available: v0.2.0 (current v0.1.0)\n", out.String())
+
+		data, err := os.ReadFile(u.exePath)
+		require.NoError(t, err)
+		require.Equal(t, "old", string(data))
+	})
+
+	t.Run("Prerelease Channel", func(t *testing.T) {
+		u, out := newUpdater(t, "v0.2.0", publicKey)
+
+		require.NoError(t, u.update(ctx, ChannelPrerelease, true))
+		require.Contains(t, out.String(), "v0.3.0-rc.1")
+	})
+
+	t.Run("Up To Date", func(t *testing.T) {
+		u, out := newUpdater(t, "v0.2.0", publicKey)
+
+		require.NoError(t, u.update(ctx, ChannelStable, false))
+		require.Equal(t, "nsh is up to date (v0.2.0)\n", out.String())
+	})
+
+	t.Run("Signed", func(t *testing.T) {
+		u, out := newUpdater(t, "v0.1.0", publicKey)
+
+		require.NoError(t, u.update(ctx, ChannelStable, false))
+		require.Equal(t, "Updated nsh from v0.1.0 to v0.2.0\n", out.String())
+
+		data, err := os.ReadFile(u.exePath)
+		require.NoError(t, err)
+		require.Equal(t, binary, data)
+
+		// No temporary files should be left behind.
+		entries, err := os.ReadDir(filepath.Dir(u.exePath))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("Wrong Key", func(t *testing.T) {
+		otherKey, _, _ := generateMinisignKey(t)
+		u, _ := newUpdater(t, "v0.1.0", otherKey)
+
+		err := u.update(ctx, ChannelStable, false)
+		require.ErrorContains(t, err, "invalid checksums signature")
+
+		data, err := os.ReadFile(u.exePath)
+		require.NoError(t, err)
+		require.Equal(t, "old", string(data))
+	})
+
+	t.Run("No Public Key", func(t *testing.T) {
+		u, _ := newUpdater(t, "v0.1.0", "")
+
+		err := u.update(ctx, ChannelStable, false)
+		require.ErrorContains(t, err, "no release public key available")
+
+		data, err := os.ReadFile(u.exePath)
+		require.NoError(t, err)
+		require.Equal(t, "old", string(data))
+	})
+
+	t.Run("Insecure", func(t *testing.T) {
+		u, out := newUpdater(t, "v0.1.0", "")
+		u.insecure = true
+
+		require.NoError(t, u.update(ctx, ChannelStable, false))
+		require.Equal(t, "Updated nsh from v0.1.0 to v0.2.0\n", out.String())
+
+		data, err := os.ReadFile(u.exePath)
+		require.NoError(t, err)
+		require.Equal(t, binary, data)
+	})
+
+	t.Run("Development Build", func(t *testing.T) {
+		u, _ := newUpdater(t, "dev", publicKey)
+
+		require.Error(t, u.update(ctx, ChannelStable, false))
+	})
+
+	t.Run("Unsupported Platform", func(t *testing.T) {
+		u, _ := newUpdater(t, "v0.1.0", publicKey)
+		u.assetName = "nsh-darwin-arm64"
+
+		// The checksum is listed, but there's no binary.
+		err := u.update(ctx, ChannelStable, false)
+		require.ErrorContains(t, err, "no binary for this platform")
+	})
+}
+
+func TestParseChecksum(t *testing.T) {
+	checksums := []byte("0000000000000000000000000000000000000000000000000000000000000001  ./nsh-linux-amd64\n" +
+		"0000000000000000000000000000000000000000000000000000000000000002 *nsh-windows-amd64.exe\n")
+
+	sum, err := parseChecksum(checksums, "nsh-windows-amd64.exe")
+	require.NoError(t, err)
+	require.Equal(t, byte(2), sum[len(sum)-1])
+
+	_, err = parseChecksum(checksums, "nsh-linux-arm64")
+	require.Error(t, err)
+}
+
+func generateMinisignKey(t *testing.T) (string, ed25519.PrivateKey, []byte) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyID := make([]byte, 8)
+	_, err = rand.Read(keyID)
+	require.NoError(t, err)
+
+	encoded := append([]byte("Ed"), keyID...)
+	encoded = append(encoded, publicKey...)
+
+	return base64.StdEncoding.EncodeToString(encoded), privateKey, keyID
+}
+
+// minisign creates a legacy (non-prehashed) minisign signature of data.
+func minisign(privateKey ed25519.PrivateKey, keyID, data []byte) []byte {
+	sig := ed25519.Sign(privateKey, data)
+	trustedComment := "timestamp:1718000000"
+	globalSig := ed25519.Sign(privateKey, append(append([]byte{}, sig...), trustedComment...))
+
+	encodedSig := append([]byte("Ed"), keyID...)
+	encodedSig = append(encodedSig, sig...)
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(encodedSig), trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig)))
+}
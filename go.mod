@@ -3,10 +3,14 @@ module github.com/noisysockets/nsh
 go 1.22.4
 
 require (
+	filippo.io/age v1.2.0
 	github.com/adrg/xdg v0.4.0
 	github.com/gofrs/flock v0.8.1
+	github.com/invopop/jsonschema v0.12.0
 	github.com/itchyny/gojq v0.12.15
+	github.com/mdp/qrterminal/v3 v3.2.1
 	github.com/miekg/dns v1.1.59
+	github.com/noisysockets/netstack v0.8.0
 	github.com/noisysockets/netutil v0.8.1
 	github.com/noisysockets/network v0.19.0
 	github.com/noisysockets/noisysockets v0.26.1
@@ -14,31 +18,40 @@ require (
 	github.com/noisysockets/telemetry v0.5.0
 	github.com/stretchr/testify v1.9.0
 	github.com/urfave/cli/v2 v2.27.2
+	github.com/zalando/go-keyring v0.2.5
+	golang.org/x/crypto v0.24.0
+	golang.org/x/mod v0.18.0
 	golang.org/x/sync v0.7.0
+	golang.org/x/term v0.21.0
+	gopkg.in/ini.v1 v1.67.0
 	gopkg.in/yaml.v3 v3.0.1
+	rsc.io/qr v0.2.0
 )
 
 require (
 	connectrpc.com/connect v1.16.2 // indirect
 	dario.cat/mergo v1.0.0 // indirect
+	github.com/alessio/shellescape v1.4.1 // indirect
 	github.com/avast/retry-go/v4 v4.6.0 // indirect
+	github.com/bahlo/generic-list-go v0.2.0 // indirect
+	github.com/buger/jsonparser v1.1.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.4 // indirect
+	github.com/danieljoos/wincred v1.2.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/google/btree v1.1.2 // indirect
 	github.com/itchyny/timefmt-go v0.1.5 // indirect
 	github.com/jinzhu/copier v0.4.0 // indirect
+	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/noisysockets/contextio v0.4.0 // indirect
-	github.com/noisysockets/netstack v0.8.0 // indirect
 	github.com/noisysockets/pinger v0.4.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/wk8/go-ordered-map/v2 v2.1.8 // indirect
 	github.com/xrash/smetrics v0.0.0-20240312152122-5f08fbb34913 // indirect
-	golang.org/x/crypto v0.24.0 // indirect
-	golang.org/x/mod v0.18.0 // indirect
 	golang.org/x/net v0.26.0 // indirect
-	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/time v0.5.0 // indirect
 	golang.org/x/tools v0.22.0 // indirect
 	google.golang.org/protobuf v1.34.2 // indirect
-	gopkg.in/ini.v1 v1.67.0 // indirect
 )
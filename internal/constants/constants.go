@@ -13,4 +13,6 @@ var (
 	TelemetryURL   = "https://telemetry.noisysockets.com/api"
 	TelemetryToken = "" // Populated at build time.
 	Version        = "dev"
+	// The minisign public key release checksums are signed with.
+	ReleasePublicKey = "" // Populated at build time.
 )
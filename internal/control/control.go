@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+// Package control implements the local control API used to talk to a running
+// nsh daemon over a Unix socket.
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	stdnet "net"
+)
+
+// API paths.
+const (
+	StatusPath  = "/v1/status"
+	ForwardPath = "/v1/forward"
+	DialPath    = "/v1/dial"
+)
+
+// The protocol control connections are upgraded to once a dial succeeds.
+const dialProtocol = "nsh-dial"
+
+// The host is ignored, as requests are always sent over the Unix socket.
+const baseURL = "http://daemon"
+
+// ForwardRequest asks the daemon to forward connections for as long as the
+// request is open.
+type ForwardRequest struct {
+	// Direction is the direction in which connections are forwarded (local or remote).
+	Direction string `json:"direction"`
+	// Protocol is the protocol to forward (tcp or udp), defaults to tcp.
+	Protocol string `json:"protocol,omitempty"`
+	// ListenAddr is the address to listen on.
+	ListenAddr string `json:"listenAddr"`
+	// DialAddr is the address to forward connections to.
+	DialAddr string `json:"dialAddr"`
+}
+
+// DialRequest asks the daemon to open a connection on the WireGuard network,
+// which is then tunnelled over the control connection.
+type DialRequest struct {
+	// Network is the network to dial, only tcp is supported.
+	Network string `json:"network"`
+	// Address is the address (host:port) to connect to.
+	Address string `json:"address"`
+}
+
+// Client is a client for the control API of a running daemon.
+type Client struct {
+	socketPath string
+	httpClient *http.Client
+}
+
+// Dial connects to the daemon listening on the given Unix socket. An error is
+// returned if no daemon is running.
+func Dial(socketPath string) (*Client, error) {
+	conn, err := stdnet.Dial("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.Close()
+
+	return &Client{
+		socketPath: socketPath,
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (stdnet.Conn, error) {
+					var d stdnet.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}, nil
+}
+
+// Status retrieves the status of each peer from the daemon, decoding it into
+// the given value.
+func (c *Client) Status(ctx context.Context, status any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+StatusPath, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(status); err != nil {
+		return fmt.Errorf("failed to decode status: %w", err)
+	}
+
+	return nil
+}
+
+// Forward asks the daemon to forward connections, it blocks until the context
+// is cancelled or the daemon stops forwarding.
+func (c *Client) Forward(ctx context.Context, forwardReq *ForwardRequest) error {
+	body, err := json.Marshal(forwardReq)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+ForwardPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Any output is an error from the daemon.
+	msg, err := io.ReadAll(resp.Body)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if len(msg) > 0 {
+		return errors.New(strings.TrimSpace(string(msg)))
+	}
+
+	return errors.New("daemon stopped forwarding")
+}
+
+// Dial asks the daemon to connect to the address on the WireGuard network,
+// returning a connection that is tunnelled through the daemon. This allows
+// short lived commands to share the daemon's network, rather than opening
+// their own.
+func (c *Client) Dial(ctx context.Context, network, address string) (stdnet.Conn, error) {
+	body, err := json.Marshal(&DialRequest{
+		Network: network,
+		Address: address,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var d stdnet.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact daemon: %w", err)
+	}
+
+	// Abort the handshake if the context is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseURL+DialPath, bytes.NewReader(body))
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", dialProtocol)
+
+	br := bufio.NewReader(conn)
+	err = dialHandshake(conn, br, req)
+	// The connection deadline has been set, so it's no longer usable.
+	if !stop() {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &bufferedConn{Conn: conn, r: br}, nil
+}
+
+func dialHandshake(conn stdnet.Conn, br *bufio.Reader, req *http.Request) error {
+	if err := req.Write(conn); err != nil {
+		return fmt.Errorf("failed to contact daemon: %w", err)
+	}
+
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("daemon returned an error: %s", strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// AcceptDial completes a successful dial request, taking over the control
+// connection so that it can be spliced with the dialed connection.
+func AcceptDial(w http.ResponseWriter) (stdnet.Conn, error) {
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", dialProtocol); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if err := brw.Flush(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return &bufferedConn{Conn: conn, r: brw.Reader}, nil
+}
+
+// bufferedConn is a connection that reads through a buffered reader, which
+// may already hold data read along with the HTTP upgrade.
+type bufferedConn struct {
+	stdnet.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// CloseWrite half closes the underlying (Unix socket) connection.
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return c.Conn.Close()
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact daemon: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("daemon returned an error: %s", strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package control_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	stdnet "net"
+
+	"github.com/noisysockets/nsh/internal/control"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDial(t *testing.T) {
+	// Unix socket paths are limited in length, so avoid t.TempDir().
+	dir, err := os.MkdirTemp("", "nsh")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	socketPath := filepath.Join(dir, "daemon.sock")
+
+	lis, err := stdnet.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+control.DialPath, func(w http.ResponseWriter, r *http.Request) {
+		var dialReq control.DialRequest
+		if err := json.NewDecoder(r.Body).Decode(&dialReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if dialReq.Address != "peer1:22" {
+			http.Error(w, "connection refused", http.StatusBadGateway)
+			return
+		}
+
+		conn, err := control.AcceptDial(w)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Echo everything back in upper case, until the client half closes.
+		data, _ := io.ReadAll(conn)
+		_, _ = conn.Write([]byte(strings.ToUpper(string(data))))
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	client, err := control.Dial(socketPath)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+
+	t.Run("Tunnel", func(t *testing.T) {
+		conn, err := client.Dial(ctx, "tcp", "peer1:22")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+
+		_, err = conn.Write([]byte("hello"))
+		require.NoError(t, err)
+
+		require.NoError(t, conn.(interface{ CloseWrite() error }).CloseWrite())
+
+		reply, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		require.Equal(t, "HELLO", string(reply))
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		_, err := client.Dial(ctx, "tcp", "peer2:22")
+		require.ErrorContains(t, err, "connection refused")
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		_, err := client.Dial(ctx, "tcp", "peer1:22")
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
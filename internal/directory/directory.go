@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+// Package directory implements the peer directory API, used by peers to
+// register themselves and to learn about the other peers in the network.
+package directory
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PeersPath is the API path used to register and list peers.
+const PeersPath = "/v1/peers"
+
+// Peer is a peer registered with the directory.
+type Peer struct {
+	// Name is the optional hostname of the peer.
+	Name string `json:"name,omitempty"`
+	// PublicKey is the public key of the peer.
+	PublicKey string `json:"publicKey"`
+	// Endpoint is the optional address other peers can reach the peer on.
+	Endpoint string `json:"endpoint,omitempty"`
+	// IPs is the list of IP addresses assigned to the peer.
+	IPs []string `json:"ips,omitempty"`
+}
+
+// Client is a client for the directory API.
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// NewClient returns a client for the directory at the given URL, requests
+// are authenticated with the token (if not empty). The optional TLS config is
+// used for HTTPS connections (eg. to present a client certificate).
+func NewClient(baseURL, token string, tlsConf *tls.Config) *Client {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	if tlsConf != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConf
+		httpClient.Transport = transport
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		token:      token,
+		httpClient: httpClient,
+	}
+}
+
+// Register adds (or refreshes) the given peer in the directory.
+func (c *Client) Register(ctx context.Context, peer *Peer) error {
+	body, err := json.Marshal(peer)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+PeersPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	return nil
+}
+
+// Peers returns the peers currently registered with the directory.
+func (c *Client) Peers(ctx context.Context) ([]Peer, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+PeersPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var peers []Peer
+	if err := json.NewDecoder(resp.Body).Decode(&peers); err != nil {
+		return nil, fmt.Errorf("failed to decode peers: %w", err)
+	}
+
+	return peers, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact directory: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		msg, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("directory returned an error: %s", strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
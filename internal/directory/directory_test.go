@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package directory_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/nsh/internal/directory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	conf := directory.ServerConfig{
+		Token:     "secret",
+		TTL:       time.Minute,
+		StatePath: filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	s, err := directory.NewServer(logger, conf)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client := directory.NewClient(srv.URL, "secret", nil)
+
+	peer1 := &directory.Peer{
+		Name:      "peer1",
+		PublicKey: "u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=",
+		Endpoint:  "192.0.2.1:51820",
+		IPs:       []string{"100.64.0.1"},
+	}
+
+	require.NoError(t, client.Register(ctx, peer1))
+
+	peers, err := client.Peers(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []directory.Peer{*peer1}, peers)
+
+	t.Run("Conflict", func(t *testing.T) {
+		err := client.Register(ctx, &directory.Peer{
+			Name:      "peer2",
+			PublicKey: "2Z0x7pbVL8jSR1/7Q6GQXyjpVvhNgxHDqmuIT1YTnWQ=",
+			IPs:       []string{"100.64.0.1"},
+		})
+		require.ErrorContains(t, err, "already registered")
+	})
+
+	t.Run("Invalid Token", func(t *testing.T) {
+		_, err := directory.NewClient(srv.URL, "wrong", nil).Peers(ctx)
+		require.ErrorContains(t, err, "invalid token")
+	})
+
+	t.Run("Persisted", func(t *testing.T) {
+		s, err := directory.NewServer(logger, conf)
+		require.NoError(t, err)
+
+		srv := httptest.NewServer(s)
+		t.Cleanup(srv.Close)
+
+		peers, err := directory.NewClient(srv.URL, "secret", nil).Peers(ctx)
+		require.NoError(t, err)
+		require.Equal(t, []directory.Peer{*peer1}, peers)
+	})
+}
+
+func TestDirectoryMutualTLS(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	ctx := context.Background()
+
+	s, err := directory.NewServer(logger, directory.ServerConfig{})
+	require.NoError(t, err)
+
+	caCert, caKey := newCertificate(t, "ca", nil, nil)
+	clientCert, clientKey := newCertificate(t, "laptop", caCert, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	srv := httptest.NewUnstartedServer(s)
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	rootCAs := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	t.Run("Client Certificate", func(t *testing.T) {
+		client := directory.NewClient(srv.URL, "", &tls.Config{
+			RootCAs: rootCAs,
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{clientCert.Raw},
+				PrivateKey:  clientKey,
+			}},
+		})
+
+		err := client.Register(ctx, &directory.Peer{
+			PublicKey: "u9F9pYOxBRQ5HpkMBE5vBOQ2CPHUFcW6vbAlZr9P0nU=",
+			IPs:       []string{"100.64.0.1"},
+		})
+		require.NoError(t, err)
+
+		require.Contains(t, logs.String(), "client=laptop")
+	})
+
+	t.Run("No Client Certificate", func(t *testing.T) {
+		client := directory.NewClient(srv.URL, "", &tls.Config{RootCAs: rootCAs})
+
+		_, err := client.Peers(ctx)
+		require.Error(t, err)
+	})
+}
+
+// newCertificate returns a certificate with the given common name, signed by
+// the parent (or self-signed if nil).
+func newCertificate(t *testing.T, commonName string, parent *x509.Certificate, parentKey ed25519.PrivateKey) (*x509.Certificate, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, privateKey
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, publicKey, parentKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert, privateKey
+}
@@ -0,0 +1,274 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package directory
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/nsh/internal/validate"
+)
+
+// ServerConfig is the configuration for a directory server.
+type ServerConfig struct {
+	// Token is the bearer token clients must present, if empty no
+	// authentication is performed.
+	Token string
+	// TTL is how long a registration lasts without being refreshed.
+	TTL time.Duration
+	// StatePath is the optional path of a file used to persist registrations
+	// across restarts.
+	StatePath string
+}
+
+type registration struct {
+	Peer     Peer      `json:"peer"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Server is a HTTP handler that serves the directory API.
+type Server struct {
+	logger *slog.Logger
+	conf   ServerConfig
+	mu     sync.Mutex
+	peers  map[string]*registration
+}
+
+// NewServer returns a new directory server, loading any persisted
+// registrations.
+func NewServer(logger *slog.Logger, conf ServerConfig) (*Server, error) {
+	s := &Server{
+		logger: logger,
+		conf:   conf,
+		peers:  make(map[string]*registration),
+	}
+
+	if conf.StatePath != "" {
+		data, err := os.ReadFile(conf.StatePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read state: %w", err)
+		}
+
+		if len(data) > 0 {
+			var registrations []*registration
+			if err := json.Unmarshal(data, &registrations); err != nil {
+				return nil, fmt.Errorf("failed to parse state: %w", err)
+			}
+
+			for _, r := range registrations {
+				s.peers[r.Peer.PublicKey] = r
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != PeersPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.logger.Debug("Directory request", slog.String("method", r.Method),
+		slog.String("remoteAddr", r.RemoteAddr), slog.String("client", clientIdentity(r)))
+
+	if s.conf.Token != "" {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.conf.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.list(w)
+	case http.MethodPost:
+		s.register(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) list(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.expire()
+
+	peers := make([]Peer, 0, len(s.peers))
+	for _, r := range s.peers {
+		peers = append(peers, r.Peer)
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(peers, func(a, b Peer) int {
+		return strings.Compare(a.PublicKey, b.PublicKey)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(peers); err != nil {
+		s.logger.Warn("Failed to write peers", slog.Any("error", err))
+	}
+}
+
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	var peer Peer
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&peer); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePeer(&peer); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	// Don't allow peers to claim names or addresses that are already in use.
+	for publicKey, existing := range s.peers {
+		if publicKey == peer.PublicKey {
+			continue
+		}
+
+		if peer.Name != "" && existing.Peer.Name == peer.Name {
+			http.Error(w, fmt.Sprintf("name %q is already registered", peer.Name), http.StatusConflict)
+			return
+		}
+
+		for _, ip := range peer.IPs {
+			if slices.Contains(existing.Peer.IPs, ip) {
+				http.Error(w, fmt.Sprintf("IP address %s is already registered", ip), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	if _, ok := s.peers[peer.PublicKey]; !ok {
+		s.logger.Info("Registered peer", slog.String("name", peer.Name), slog.String("publicKey", peer.PublicKey),
+			slog.String("client", clientIdentity(r)))
+	}
+
+	s.peers[peer.PublicKey] = &registration{
+		Peer:     peer,
+		LastSeen: time.Now(),
+	}
+
+	if err := s.save(); err != nil {
+		s.logger.Warn("Failed to save state", slog.Any("error", err))
+	}
+}
+
+// expire removes registrations that haven't been refreshed within the TTL,
+// it must be called with the lock held.
+func (s *Server) expire() {
+	if s.conf.TTL <= 0 {
+		return
+	}
+
+	for publicKey, r := range s.peers {
+		if time.Since(r.LastSeen) > s.conf.TTL {
+			s.logger.Info("Registration expired", slog.String("name", r.Peer.Name), slog.String("publicKey", publicKey))
+
+			delete(s.peers, publicKey)
+		}
+	}
+}
+
+// save persists the registrations to the state file (if any), it must be
+// called with the lock held.
+func (s *Server) save() error {
+	if s.conf.StatePath == "" {
+		return nil
+	}
+
+	registrations := make([]*registration, 0, len(s.peers))
+	for _, r := range s.peers {
+		registrations = append(registrations, r)
+	}
+
+	data, err := json.Marshal(registrations)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := s.conf.StatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.conf.StatePath)
+}
+
+// clientIdentity returns the identity of the client certificate presented
+// with the request (if any).
+func clientIdentity(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+
+	// Certificates issued by some CAs only include SANs.
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+
+	return cert.SerialNumber.String()
+}
+
+func validatePeer(peer *Peer) error {
+	if err := validate.Key(peer.PublicKey); err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	if peer.Endpoint != "" {
+		if err := validate.Endpoint(peer.Endpoint); err != nil {
+			return err
+		}
+	}
+
+	if len(peer.IPs) == 0 {
+		return fmt.Errorf("at least one IP address is required")
+	}
+
+	for i, ip := range peer.IPs {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return fmt.Errorf("invalid IP address %q: %w", ip, err)
+		}
+
+		// Normalize the address so duplicates can be detected.
+		peer.IPs[i] = addr.String()
+	}
+
+	return nil
+}
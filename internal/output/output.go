@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+// Package output writes command results in the format selected with the
+// --output flag, so they can be consumed by scripts.
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats.
+const (
+	// Table is the default human readable format.
+	Table = "table"
+	// Text is an alias for Table.
+	Text = "text"
+	JSON = "json"
+	YAML = "yaml"
+)
+
+// Formats is the list of supported output formats.
+var Formats = []string{Table, JSON, YAML}
+
+// Validate returns an error if the output format is not supported.
+func Validate(format string) error {
+	switch format {
+	case Table, Text, JSON, YAML:
+		return nil
+	default:
+		return fmt.Errorf("unsupported output format %q, expected one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// IsHuman returns whether the output format is meant for humans, rather
+// than machines.
+func IsHuman(format string) bool {
+	return format == Table || format == Text
+}
+
+// Write writes v to w in the machine readable output format. Field names
+// follow the json struct tags in both JSON and YAML.
+func Write(w io.Writer, format string, v any) error {
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case YAML:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		// JSON is valid YAML, decoding it into a node keeps the field order.
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+
+		return enc.Close()
+	default:
+		return fmt.Errorf("unsupported output format %q", format)
+	}
+}
+
+// blockStyle resets the flow (JSON) style of the decoded nodes, so they are
+// written as regular block style YAML.
+func blockStyle(node *yaml.Node) {
+	if node.Kind != yaml.ScalarNode {
+		node.Style = 0
+	} else {
+		node.Style &^= yaml.DoubleQuotedStyle
+	}
+
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
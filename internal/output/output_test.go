@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package output_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/output"
+	"github.com/stretchr/testify/require"
+)
+
+type peer struct {
+	Name      string   `json:"name,omitempty"`
+	PublicKey string   `json:"publicKey"`
+	IPs       []string `json:"ips,omitempty"`
+	Reachable bool     `json:"reachable"`
+}
+
+func TestWrite(t *testing.T) {
+	peers := []peer{
+		{Name: "peer1", PublicKey: "key1", IPs: []string{"100.64.0.1"}, Reachable: true},
+		{PublicKey: "true"},
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, output.Write(&buf, output.JSON, peers))
+
+		require.JSONEq(t, `[
+			{"name": "peer1", "publicKey": "key1", "ips": ["100.64.0.1"], "reachable": true},
+			{"publicKey": "true", "reachable": false}
+		]`, buf.String())
+	})
+
+	t.Run("YAML", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, output.Write(&buf, output.YAML, peers))
+
+		// Field order is preserved, and strings that look like other types
+		// are still quoted.
+		require.Equal(t, `- name: peer1
+  publicKey: key1
+  ips:
+    - 100.64.0.1
+  reachable: true
+- publicKey: "true"
+  reachable: false
+`, buf.String())
+	})
+}
+
+func TestValidate(t *testing.T) {
+	for _, format := range []string{output.Table, output.Text, output.JSON, output.YAML} {
+		require.NoError(t, output.Validate(format))
+	}
+
+	require.Error(t, output.Validate("xml"))
+}
@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// AccessList restricts which WireGuard network addresses can use a service.
+// A nil access list allows all addresses.
+type AccessList struct {
+	// Allow is the list of prefixes that are allowed, if empty all addresses
+	// not explicitly denied are allowed.
+	Allow []netip.Prefix
+	// Deny is the list of prefixes that are denied, deny rules take
+	// precedence over allow rules.
+	Deny []netip.Prefix
+}
+
+// ParseAccessList parses lists of allowed and denied CIDR prefixes (or bare
+// IP addresses) into an access list. If both lists are empty, nil is
+// returned.
+func ParseAccessList(allow, deny []string) (*AccessList, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+
+	var l AccessList
+	var err error
+	if l.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+
+	if l.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// Allowed returns whether the given address is allowed to use the service.
+func (l *AccessList) Allowed(addr netip.Addr) bool {
+	if l == nil {
+		return true
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range l.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	if len(l.Allow) == 0 {
+		return true
+	}
+
+	for _, prefix := range l.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Middleware returns a HTTP handler that rejects requests from addresses that
+// are not allowed, before passing the rest on to next.
+func (l *AccessList) Middleware(logger *slog.Logger, next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !l.Allowed(addrPort.Addr()) {
+			logger.Warn("Denied request", slog.String("remoteAddr", r.RemoteAddr))
+
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+			}
+
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessList(t *testing.T) {
+	acl, err := service.ParseAccessList([]string{"100.64.0.0/24", "fd00::/64"}, []string{"100.64.0.13"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"100.64.0.1", true},
+		{"::ffff:100.64.0.1", true},
+		{"100.64.0.13", false},
+		{"100.64.1.1", false},
+		{"fd00::1", true},
+		{"fd01::1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			require.Equal(t, tt.allowed, acl.Allowed(netip.MustParseAddr(tt.addr)))
+		})
+	}
+
+	t.Run("DenyOnly", func(t *testing.T) {
+		acl, err := service.ParseAccessList(nil, []string{"100.64.0.0/24"})
+		require.NoError(t, err)
+
+		require.False(t, acl.Allowed(netip.MustParseAddr("100.64.0.1")))
+		require.True(t, acl.Allowed(netip.MustParseAddr("100.64.1.1")))
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		acl, err := service.ParseAccessList(nil, nil)
+		require.NoError(t, err)
+		require.Nil(t, acl)
+
+		require.True(t, acl.Allowed(netip.MustParseAddr("100.64.0.1")))
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := service.ParseAccessList([]string{"100.64.0.0/33"}, nil)
+		require.Error(t, err)
+
+		_, err = service.ParseAccessList(nil, []string{"peer1"})
+		require.Error(t, err)
+	})
+}
+
+func TestAccessListMiddleware(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	acl, err := service.ParseAccessList([]string{"100.64.0.0/24"}, nil)
+	require.NoError(t, err)
+
+	h := acl.Middleware(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	req.RemoteAddr = "100.64.0.1:1234"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	req.RemoteAddr = "[fd00::1]:1234"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
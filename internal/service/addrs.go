@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	stdnet "net"
+	"net/netip"
+
+	"github.com/noisysockets/network"
+)
+
+// listenAddrs returns every address a listener bound to listenAddr can be
+// reached on. A listener bound to the unspecified address (eg. ":80") is
+// listening on all of the interface addresses of the network, in both
+// address families, but its Addr() only reports the first of them.
+func listenAddrs(net network.Network, listenAddr string, lisAddr stdnet.Addr) []string {
+	host, port, err := stdnet.SplitHostPort(lisAddr.String())
+	if err != nil {
+		return []string{lisAddr.String()}
+	}
+
+	bindHost, _, err := stdnet.SplitHostPort(listenAddr)
+	if err != nil || !(bindHost == "" || bindHost == "0.0.0.0" || bindHost == "::") {
+		return []string{stdnet.JoinHostPort(host, port)}
+	}
+
+	ifAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return []string{stdnet.JoinHostPort(host, port)}
+	}
+
+	var addrs []string
+	for _, ifAddr := range ifAddrs {
+		var addr netip.Addr
+		if prefix, err := netip.ParsePrefix(ifAddr.String()); err == nil {
+			addr = prefix.Addr()
+		} else if addr, err = netip.ParseAddr(ifAddr.String()); err != nil {
+			continue
+		}
+
+		// Link-local addresses aren't usable without a zone, and listeners
+		// are never bound to broadcast or multicast addresses.
+		if addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.Unmap() == netip.AddrFrom4([4]byte{255, 255, 255, 255}) {
+			continue
+		}
+
+		if bindHost == "0.0.0.0" && !addr.Unmap().Is4() {
+			continue
+		}
+
+		// JoinHostPort takes care of bracketing IPv6 addresses.
+		addrs = append(addrs, stdnet.JoinHostPort(addr.Unmap().String(), port))
+	}
+
+	if len(addrs) == 0 {
+		return []string{stdnet.JoinHostPort(host, port)}
+	}
+
+	return addrs
+}
+
+// listenURLs returns the URLs a HTTP server bound to listenAddr can be
+// reached on.
+func listenURLs(net network.Network, listenAddr string, lisAddr stdnet.Addr) []string {
+	addrs := listenAddrs(net, listenAddr, lisAddr)
+
+	urls := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		urls = append(urls, "http://"+addr)
+	}
+
+	return urls
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"net"
+	"testing"
+
+	"github.com/noisysockets/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenAddrs(t *testing.T) {
+	hostNet := network.Host()
+
+	t.Run("Specific", func(t *testing.T) {
+		addrs := listenAddrs(hostNet, "127.0.0.1:8080", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+		require.Equal(t, []string{"127.0.0.1:8080"}, addrs)
+	})
+
+	t.Run("Unspecified", func(t *testing.T) {
+		addrs := listenAddrs(hostNet, ":8080", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080})
+		require.Contains(t, addrs, "127.0.0.1:8080")
+
+		for _, addr := range addrs {
+			_, _, err := net.SplitHostPort(addr)
+			require.NoError(t, err, addr)
+		}
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		addrs := listenAddrs(hostNet, "[::1]:8080", &net.TCPAddr{IP: net.IPv6loopback, Port: 8080})
+		require.Equal(t, []string{"[::1]:8080"}, addrs)
+	})
+
+	t.Run("Unix", func(t *testing.T) {
+		addrs := listenAddrs(hostNet, "/tmp/nsh.sock", &net.UnixAddr{Name: "/tmp/nsh.sock", Net: "unix"})
+		require.Equal(t, []string{"/tmp/nsh.sock"}, addrs)
+	})
+}
+
+func TestListenURLs(t *testing.T) {
+	urls := listenURLs(network.Host(), "[fd00::1]:80", &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 80})
+	require.Equal(t, []string{"http://[fd00::1]:80"}, urls)
+}
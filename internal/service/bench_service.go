@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+)
+
+var _ Service = (*BenchService)(nil)
+
+// DefaultBenchPort is the default port the benchmark service listens on.
+const DefaultBenchPort = 5201
+
+// BenchService is a service that measures TCP throughput from clients. A
+// client streams data to the service until it closes its side of the
+// connection, the service then replies with the number of bytes received
+// (as a big-endian uint64).
+type BenchService struct {
+	logger *slog.Logger
+	port   int
+}
+
+// Bench returns a new benchmark service that listens on the given port of the
+// WireGuard network.
+func Bench(logger *slog.Logger, port int) *BenchService {
+	return &BenchService{
+		logger: logger,
+		port:   port,
+	}
+}
+
+func (s *BenchService) Serve(ctx context.Context, net network.Network) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen on port %d: %w", s.port, err)
+	}
+	defer lis.Close()
+
+	s.logger.Info("Listening for benchmark connections", slog.String("address", lis.Addr().String()))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger := s.logger.With(slog.String("remoteAddr", conn.RemoteAddr().String()))
+
+			if err := s.handle(ctx, logger, conn); err != nil {
+				logger.Warn("Failed to run benchmark", slog.Any("error", err))
+			}
+		}()
+	}
+}
+
+func (s *BenchService) handle(ctx context.Context, logger *slog.Logger, conn stdnet.Conn) error {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+
+	logger.Debug("Receiving benchmark data")
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, conn)
+	if err != nil {
+		return fmt.Errorf("failed to receive data: %w", err)
+	}
+
+	elapsed := time.Since(start)
+
+	logger.Info("Benchmark complete",
+		slog.Int64("bytes", n), slog.Duration("duration", elapsed),
+		slog.Float64("mbps", float64(n)*8/elapsed.Seconds()/1e6))
+
+	if err := binary.Write(conn, binary.BigEndian, uint64(n)); err != nil {
+		return fmt.Errorf("failed to write result: %w", err)
+	}
+
+	return nil
+}
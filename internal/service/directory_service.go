@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/noisysockets/network"
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/directory"
+)
+
+var _ Service = (*DirectoryService)(nil)
+
+// DirectoryService registers this peer with a directory server, and adds the
+// other peers registered with the directory to the network. Peers that are
+// present in the configuration file take precedence over the directory, and
+// directory peers can't claim the names or addresses of configured peers
+// (or this peer).
+type DirectoryService struct {
+	logger   *slog.Logger
+	client   *directory.Client
+	self     *directory.Peer
+	conf     *latestconfig.Config
+	interval time.Duration
+	// Peers that have been added from the directory, by public key.
+	learned map[string]directory.Peer
+	// Directory peers that were ignored in the last sync, by public key.
+	rejected map[string]struct{}
+}
+
+// Directory returns a new directory service, that registers self with the
+// directory and refreshes the set of peers every interval.
+func Directory(logger *slog.Logger, client *directory.Client, self *directory.Peer,
+	conf *latestconfig.Config, interval time.Duration) *DirectoryService {
+	return &DirectoryService{
+		logger:   logger,
+		client:   client,
+		self:     self,
+		conf:     conf,
+		interval: interval,
+		learned:  make(map[string]directory.Peer),
+		rejected: make(map[string]struct{}),
+	}
+}
+
+func (s *DirectoryService) Serve(ctx context.Context, _ network.Network) error {
+	pm, ok := peerManagerFromContext(ctx)
+	if !ok {
+		return errors.New("network does not support adding peers")
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sync(ctx, pm); err != nil && ctx.Err() == nil {
+			s.logger.Warn("Failed to sync with directory", slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DirectoryService) sync(ctx context.Context, pm PeerManager) error {
+	if err := s.client.Register(ctx, s.self); err != nil {
+		return err
+	}
+
+	peers, err := s.client.Peers(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The configured peers may be reloaded concurrently. The lock isn't held
+	// while talking to the directory, so a slow directory can't hold up
+	// reloads.
+	pm.Lock()
+	defer pm.Unlock()
+
+	configured := make(map[string]bool)
+	for _, peerConf := range s.conf.Peers {
+		configured[peerConf.PublicKey] = true
+	}
+
+	rejected := make(map[string]struct{})
+	current := make(map[string]directory.Peer)
+	for _, peer := range peers {
+		if peer.PublicKey == s.self.PublicKey || configured[peer.PublicKey] {
+			continue
+		}
+
+		if err := s.checkPeer(peer); err != nil {
+			// Only warn the first time around.
+			if _, ok := s.rejected[peer.PublicKey]; !ok {
+				s.logger.Warn("Ignoring directory peer",
+					slog.String("name", peer.Name), slog.String("publicKey", peer.PublicKey), slog.Any("error", err))
+			}
+			rejected[peer.PublicKey] = struct{}{}
+			continue
+		}
+
+		current[peer.PublicKey] = peer
+	}
+	s.rejected = rejected
+
+	// Remove peers that are no longer registered (or have changed).
+	for publicKey, peer := range s.learned {
+		if newPeer, ok := current[publicKey]; ok && peerEqual(peer, newPeer) {
+			continue
+		}
+
+		var pk types.NoisePublicKey
+		if err := pk.UnmarshalText([]byte(publicKey)); err != nil {
+			continue
+		}
+
+		s.logger.Info("Removing peer", slog.String("name", peer.Name), slog.String("publicKey", publicKey))
+
+		pm.RemovePeer(pk)
+		delete(s.learned, publicKey)
+	}
+
+	for publicKey, peer := range current {
+		if _, ok := s.learned[publicKey]; ok {
+			continue
+		}
+
+		s.logger.Info("Adding peer from directory", slog.String("name", peer.Name), slog.String("publicKey", publicKey))
+
+		if err := pm.AddPeer(latestconfig.PeerConfig{
+			Name:      peer.Name,
+			PublicKey: peer.PublicKey,
+			Endpoint:  peer.Endpoint,
+			IPs:       peer.IPs,
+		}); err != nil {
+			s.logger.Warn("Failed to add peer", slog.String("publicKey", publicKey), slog.Any("error", err))
+			continue
+		}
+
+		s.learned[publicKey] = peer
+	}
+
+	return nil
+}
+
+func peerEqual(a, b directory.Peer) bool {
+	return a.Name == b.Name && a.Endpoint == b.Endpoint && slices.Equal(a.IPs, b.IPs)
+}
+
+// checkPeer returns an error if the directory peer claims the name or any of
+// the addresses of this peer, a configured peer, or a route. As traffic is
+// routed by the peers' addresses, this would otherwise allow anyone able to
+// register with the directory to intercept it.
+func (s *DirectoryService) checkPeer(peer directory.Peer) error {
+	if peer.Name != "" {
+		names := []string{s.self.Name}
+		for _, peerConf := range s.conf.Peers {
+			names = append(names, peerConf.Name)
+		}
+
+		for _, name := range names {
+			if strings.EqualFold(peer.Name, name) {
+				return fmt.Errorf("name %q is already in use", peer.Name)
+			}
+		}
+	}
+
+	var reserved []netip.Prefix
+	addReserved := func(addrs ...string) {
+		for _, addr := range addrs {
+			// Invalid addresses are reported when loading the config.
+			if prefixes, err := parsePrefixes([]string{addr}); err == nil {
+				reserved = append(reserved, prefixes...)
+			}
+		}
+	}
+
+	addReserved(s.conf.IPs...)
+	addReserved(s.self.IPs...)
+	for _, peerConf := range s.conf.Peers {
+		addReserved(peerConf.IPs...)
+	}
+	for _, routeConf := range s.conf.Routes {
+		addReserved(routeConf.Destination)
+	}
+
+	prefixes, err := parsePrefixes(peer.IPs)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range prefixes {
+		for _, r := range reserved {
+			if prefix.Overlaps(r) {
+				return fmt.Errorf("address %q overlaps %q", prefix, r)
+			}
+		}
+	}
+
+	return nil
+}
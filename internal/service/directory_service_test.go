@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+	"github.com/noisysockets/nsh/internal/directory"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryService(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	s, err := directory.NewServer(logger, directory.ServerConfig{TTL: time.Minute})
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	client := directory.NewClient(srv.URL, "", nil)
+
+	gatewayKey := newPublicKey(t)
+	conf := &latestconfig.Config{
+		Name: "self",
+		IPs:  []string{"100.64.0.1", "fd00::1"},
+		Peers: []latestconfig.PeerConfig{
+			{Name: "gateway", PublicKey: gatewayKey, IPs: []string{"100.64.0.2"}},
+		},
+		Routes: []latestconfig.RouteConfig{
+			{Destination: "10.0.0.0/8", Via: "gateway"},
+		},
+	}
+
+	self := &directory.Peer{Name: "self", PublicKey: newPublicKey(t), IPs: []string{"100.64.0.1"}}
+
+	register := func(name string, ips ...string) string {
+		publicKey := newPublicKey(t)
+		require.NoError(t, client.Register(ctx, &directory.Peer{
+			Name:      name,
+			PublicKey: publicKey,
+			IPs:       ips,
+		}))
+		return publicKey
+	}
+
+	goodKey := register("peer1", "100.64.0.10")
+	// Claims the address of the gateway.
+	register("evil1", "100.64.0.2")
+	// Claims one of this peer's addresses.
+	register("evil2", "fd00::1")
+	// Claims an address behind the gateway.
+	register("evil3", "10.1.2.3")
+	// Claims the name of the gateway.
+	register("Gateway", "100.64.0.11")
+
+	pm := &fakePeerManager{}
+
+	ctx, cancel := context.WithCancel(service.WithPeerManager(ctx, pm))
+	t.Cleanup(cancel)
+
+	svc := service.Directory(logger, client, self, conf, time.Hour)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Serve(ctx, nil)
+	}()
+
+	require.Eventually(t, func() bool {
+		return len(pm.publicKeys()) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	require.Equal(t, []string{goodKey}, pm.publicKeys())
+}
+
+func newPublicKey(t *testing.T) string {
+	privateKey, err := types.NewPrivateKey()
+	require.NoError(t, err)
+
+	return privateKey.Public().String()
+}
+
+type fakePeerManager struct {
+	sync.Mutex
+	// Guards peers separately, so they can be inspected while the peer
+	// manager lock is held.
+	mu    sync.Mutex
+	peers []latestconfig.PeerConfig
+}
+
+func (pm *fakePeerManager) AddPeer(peerConf latestconfig.PeerConfig) error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.peers = append(pm.peers, peerConf)
+	return nil
+}
+
+func (pm *fakePeerManager) RemovePeer(publicKey types.NoisePublicKey) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.peers = slices.DeleteFunc(pm.peers, func(peerConf latestconfig.PeerConfig) bool {
+		return peerConf.PublicKey == publicKey.String()
+	})
+}
+
+func (pm *fakePeerManager) publicKeys() []string {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	var publicKeys []string
+	for _, peerConf := range pm.peers {
+		publicKeys = append(publicKeys, peerConf.PublicKey)
+	}
+
+	return publicKeys
+}
@@ -15,6 +15,8 @@ import (
 	"fmt"
 	"log/slog"
 	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -28,19 +30,38 @@ import (
 
 var _ Service = (*DNSService)(nil)
 
+// DNSServiceConfig is the configuration for the DNS service.
+type DNSServiceConfig struct {
+	// EnableNAT64 enables DNS64 for recursive queries.
+	EnableNAT64 bool
+	// NAT64Prefix is the prefix used for DNS64.
+	NAT64Prefix netip.Prefix
+	// Hosts maps addresses on the WireGuard network to peer names, it is used
+	// to answer reverse (PTR) queries.
+	Hosts map[netip.Addr]string
+	// DisableNetworkListener disables listening on port 53 of the WireGuard
+	// network.
+	DisableNetworkListener bool
+	// HostNet is the host network, required if HostListenAddrs is set.
+	HostNet network.Network
+	// HostListenAddrs are additional addresses to listen on, on the host network.
+	HostListenAddrs []string
+	// SplitDomains are domains whose names are resolved using the DNS servers
+	// on the WireGuard network, rather than the system resolver.
+	SplitDomains []string
+}
+
 // DNSService is a DNS service that provides recursive and authoritative DNS resolution.
 type DNSService struct {
-	logger      *slog.Logger
-	enableNAT64 bool
-	nat64Prefix netip.Prefix
+	logger *slog.Logger
+	conf   *DNSServiceConfig
 }
 
 // DNS returns a new DNS service.
-func DNS(logger *slog.Logger, enableNAT64 bool, nat64Prefix netip.Prefix) *DNSService {
+func DNS(logger *slog.Logger, conf *DNSServiceConfig) *DNSService {
 	return &DNSService{
-		logger:      logger,
-		enableNAT64: enableNAT64,
-		nat64Prefix: nat64Prefix,
+		logger: logger,
+		conf:   conf,
 	}
 }
 
@@ -60,11 +81,11 @@ func (s *DNSService) Serve(ctx context.Context, net network.Network) error {
 		return fmt.Errorf("failed to get system resolver: %w", err)
 	}
 
-	if s.enableNAT64 {
-		s.logger.Info("Enabling DNS64", slog.String("prefix", s.nat64Prefix.String()))
+	if s.conf.EnableNAT64 {
+		s.logger.Info("Enabling DNS64", slog.String("prefix", s.conf.NAT64Prefix.String()))
 
 		upstreamResolver = resolver.DNS64(upstreamResolver, &resolver.DNS64ResolverConfig{
-			Prefix: &s.nat64Prefix,
+			Prefix: &s.conf.NAT64Prefix,
 		})
 	}
 
@@ -161,20 +182,122 @@ func (s *DNSService) Serve(ctx context.Context, net network.Network) error {
 		}
 	})
 
+	// Names on the WireGuard network are resolved using the network's own
+	// resolver (peer names, and any DNS servers on the network).
+	networkHandler := func(zone string, authoritative bool) dns.HandlerFunc {
+		return func(w dns.ResponseWriter, req *dns.Msg) {
+			reply := &dns.Msg{}
+			reply.SetReply(req)
+			reply.Authoritative = authoritative
+			reply.RecursionAvailable = true
+
+			logger := s.logger.With(
+				slog.String("zone", zone),
+				slog.String("remoteAddr", w.RemoteAddr().String()),
+				slog.Int("id", int(req.Id)))
+
+			logger.Info("Resolving DNS question")
+
+			defer func() {
+				if err := w.WriteMsg(reply); err != nil {
+					logger.Error("Failed to write DNS response", slog.Any("error", err))
+				}
+			}()
+
+			for _, q := range req.Question {
+				logger = logger.With(
+					slog.String("name", q.Name),
+					slog.String("qType", dns.TypeToString[q.Qtype]))
+
+				logger.Debug("Received DNS question")
+
+				addrs, err := net.LookupHost(q.Name)
+				if err != nil {
+					if strings.Contains(err.Error(), resolver.ErrNoSuchHost.Error()) {
+						reply.Rcode = dns.RcodeNameError
+						return
+					}
+
+					logger.Warn("Failed to lookup DNS question", slog.Any("error", err))
+					reply.Rcode = dns.RcodeServerFailure
+					return
+				}
+
+				var ipv4Addrs, ipv6Addrs []stdnet.IP
+				for _, addr := range addrs {
+					ip := stdnet.ParseIP(addr)
+					if ip == nil {
+						logger.Warn("Failed to parse IP address", slog.String("address", addr))
+						continue
+					}
+
+					if ip.To4() != nil {
+						ipv4Addrs = append(ipv4Addrs, ip)
+					} else {
+						ipv6Addrs = append(ipv6Addrs, ip)
+					}
+				}
+
+				switch q.Qtype {
+				case dns.TypeA:
+					logger.Debug("Answering DNS question", slog.Int("answers", len(ipv4Addrs)))
+
+					for _, addr := range ipv4Addrs {
+						reply.Answer = append(reply.Answer, &dns.A{
+							Hdr: dns.RR_Header{
+								Name:   q.Name,
+								Rrtype: dns.TypeA,
+								Class:  dns.ClassINET,
+								Ttl:    60,
+							},
+							A: addr,
+						})
+					}
+				case dns.TypeAAAA:
+					logger.Debug("Answering DNS question", slog.Int("answers", len(ipv6Addrs)))
+
+					for _, addr := range ipv6Addrs {
+						reply.Answer = append(reply.Answer, &dns.AAAA{
+							Hdr: dns.RR_Header{
+								Name:   q.Name,
+								Rrtype: dns.TypeAAAA,
+								Class:  dns.ClassINET,
+								Ttl:    60,
+							},
+							AAAA: addr,
+						})
+					}
+				default:
+					logger.Warn("Unsupported DNS query type")
+
+					reply.Rcode = dns.RcodeNotImplemented
+				}
+			}
+		}
+	}
+
 	s.logger.Info("Registering authoritive DNS handler", slog.String("zone", domain))
 
-	mux.HandleFunc(domain, func(w dns.ResponseWriter, req *dns.Msg) {
+	mux.HandleFunc(domain, networkHandler(domain, true))
+
+	for _, zone := range s.conf.SplitDomains {
+		zone = dns.Fqdn(zone)
+
+		s.logger.Info("Registering split DNS handler", slog.String("zone", zone))
+
+		mux.HandleFunc(zone, networkHandler(zone, false))
+	}
+
+	reverseHandler := func(w dns.ResponseWriter, req *dns.Msg) {
 		reply := &dns.Msg{}
 		reply.SetReply(req)
-		reply.Authoritative = true
 		reply.RecursionAvailable = true
 
 		logger := s.logger.With(
-			slog.String("zone", domain),
 			slog.String("remoteAddr", w.RemoteAddr().String()),
 			slog.Int("id", int(req.Id)))
 
-		logger.Info("Resolving DNS question")
+		logger.Info("Resolving reverse DNS question")
 
 		defer func() {
 			if err := w.WriteMsg(reply); err != nil {
@@ -189,99 +312,112 @@ func (s *DNSService) Serve(ctx context.Context, net network.Network) error {
 
 			logger.Debug("Received DNS question")
 
-			addrs, err := net.LookupHost(q.Name)
-			if err != nil {
-				if strings.Contains(err.Error(), resolver.ErrNoSuchHost.Error()) {
-					reply.Rcode = dns.RcodeNameError
-					return
-				}
+			if q.Qtype != dns.TypePTR {
+				logger.Warn("Unsupported DNS query type")
 
-				logger.Warn("Failed to lookup DNS question", slog.Any("error", err))
-				reply.Rcode = dns.RcodeServerFailure
+				reply.Rcode = dns.RcodeNotImplemented
 				return
 			}
 
-			var ipv4Addrs, ipv6Addrs []stdnet.IP
-			for _, addr := range addrs {
-				ip := stdnet.ParseIP(addr)
-				if ip == nil {
-					logger.Warn("Failed to parse IP address", slog.String("address", addr))
-					continue
-				}
-
-				if ip.To4() != nil {
-					ipv4Addrs = append(ipv4Addrs, ip)
-				} else {
-					ipv6Addrs = append(ipv6Addrs, ip)
-				}
+			addr, ok := addrFromReverseName(q.Name)
+			if !ok {
+				reply.Rcode = dns.RcodeNameError
+				return
 			}
 
-			switch q.Qtype {
-			case dns.TypeA:
-				logger.Debug("Answering DNS question", slog.Int("answers", len(ipv4Addrs)))
+			var names []string
+			if name, ok := s.conf.Hosts[addr]; ok {
+				reply.Authoritative = true
+				names = []string{name + "." + domain}
+			} else {
+				if !req.RecursionDesired {
+					logger.Warn("Non-recursive query")
 
-				for _, addr := range ipv4Addrs {
-					reply.Answer = append(reply.Answer, &dns.A{
-						Hdr: dns.RR_Header{
-							Name:   q.Name,
-							Rrtype: dns.TypeA,
-							Class:  dns.ClassINET,
-							Ttl:    60,
-						},
-						A: addr,
-					})
+					reply.Rcode = dns.RcodeRefused
+					return
 				}
-			case dns.TypeAAAA:
-				logger.Debug("Answering DNS question", slog.Int("answers", len(ipv6Addrs)))
 
-				for _, addr := range ipv6Addrs {
-					reply.Answer = append(reply.Answer, &dns.AAAA{
-						Hdr: dns.RR_Header{
-							Name:   q.Name,
-							Rrtype: dns.TypeAAAA,
-							Class:  dns.ClassINET,
-							Ttl:    60,
-						},
-						AAAA: addr,
-					})
+				var err error
+				names, err = stdnet.DefaultResolver.LookupAddr(ctx, addr.String())
+				if err != nil {
+					var dnsErr *stdnet.DNSError
+					if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+						reply.Rcode = dns.RcodeNameError
+						return
+					}
+
+					logger.Warn("Failed to lookup DNS question", slog.Any("error", err))
+					reply.Rcode = dns.RcodeServerFailure
+					return
 				}
-			default:
-				logger.Warn("Unsupported DNS query type")
+			}
 
-				reply.Rcode = dns.RcodeNotImplemented
+			logger.Debug("Answering DNS question", slog.Int("answers", len(names)))
+
+			for _, name := range names {
+				reply.Answer = append(reply.Answer, &dns.PTR{
+					Hdr: dns.RR_Header{
+						Name:   q.Name,
+						Rrtype: dns.TypePTR,
+						Class:  dns.ClassINET,
+						Ttl:    60,
+					},
+					Ptr: dns.Fqdn(name),
+				})
 			}
 		}
-	})
+	}
 
-	pc, err := net.ListenPacket("udp", ":53")
-	if err != nil {
-		return fmt.Errorf("failed to listen on UDP port: %w", err)
+	for _, zone := range []string{"in-addr.arpa.", "ip6.arpa."} {
+		s.logger.Info("Registering reverse DNS handler", slog.String("zone", zone))
+
+		mux.HandleFunc(zone, reverseHandler)
 	}
-	defer pc.Close()
 
-	// For UDP queries.
-	udpServer := &dns.Server{
-		Handler:    mux,
-		PacketConn: pc,
+	type listenAddr struct {
+		net  network.Network
+		addr string
 	}
 
-	lis, err := net.Listen("tcp", ":53")
-	if err != nil {
-		return fmt.Errorf("failed to listen on TCP port: %w", err)
+	var listenAddrs []listenAddr
+	if !s.conf.DisableNetworkListener {
+		listenAddrs = append(listenAddrs, listenAddr{net: net, addr: ":53"})
+	}
+
+	for _, addr := range s.conf.HostListenAddrs {
+		listenAddrs = append(listenAddrs, listenAddr{net: s.conf.HostNet, addr: addr})
 	}
-	defer lis.Close()
 
-	// For TCP queries.
-	tcpServer := &dns.Server{
-		Handler:  mux,
-		Listener: lis,
+	if len(listenAddrs) == 0 {
+		return errors.New("no listen addresses")
+	}
+
+	var servers []*dns.Server
+	for _, la := range listenAddrs {
+		pc, err := la.net.ListenPacket("udp", la.addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on UDP port: %w", err)
+		}
+		defer pc.Close()
+
+		lis, err := la.net.Listen("tcp", la.addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on TCP port: %w", err)
+		}
+		defer lis.Close()
+
+		// We have to use multiple server instances as we can't serve both UDP
+		// and TCP at the same time on the one server instance.
+		servers = append(servers,
+			&dns.Server{Handler: mux, PacketConn: pc},
+			&dns.Server{Handler: mux, Listener: lis})
+
+		s.logger.Info("Listening for DNS queries", slog.String("address", lis.Addr().String()))
 	}
 
 	g, ctx := errgroup.WithContext(ctx)
 
-	// We have to use multiple server instances as we can't serve both UDP and TCP
-	// at the same time on the one server instance.
-	for _, srv := range []*dns.Server{udpServer, tcpServer} {
+	for _, srv := range servers {
 		srv := srv
 
 		g.Go(func() error {
@@ -302,11 +438,58 @@ func (s *DNSService) Serve(ctx context.Context, net network.Network) error {
 		})
 	}
 
-	s.logger.Info("Listening for DNS queries", slog.String("address", lis.Addr().String()))
-
 	if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
 		return fmt.Errorf("failed to serve DNS: %w", err)
 	}
 
 	return nil
 }
+
+// addrFromReverseName parses a reverse DNS name (eg. "1.0.0.10.in-addr.arpa.")
+// into the address it refers to.
+func addrFromReverseName(name string) (netip.Addr, bool) {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	if labels, ok := strings.CutSuffix(name, ".in-addr.arpa."); ok {
+		octets := strings.Split(labels, ".")
+		if len(octets) != 4 {
+			return netip.Addr{}, false
+		}
+
+		slices.Reverse(octets)
+
+		addr, err := netip.ParseAddr(strings.Join(octets, "."))
+		return addr, err == nil
+	}
+
+	if labels, ok := strings.CutSuffix(name, ".ip6.arpa."); ok {
+		nibbles := strings.Split(labels, ".")
+		if len(nibbles) != 32 {
+			return netip.Addr{}, false
+		}
+
+		var b [16]byte
+		for i, nibble := range nibbles {
+			if len(nibble) != 1 {
+				return netip.Addr{}, false
+			}
+
+			v, err := strconv.ParseUint(nibble, 16, 8)
+			if err != nil {
+				return netip.Addr{}, false
+			}
+
+			// Nibbles are in reverse order, least significant first.
+			pos := 31 - i
+			if pos%2 == 0 {
+				b[pos/2] |= byte(v) << 4
+			} else {
+				b[pos/2] |= byte(v)
+			}
+		}
+
+		return netip.AddrFrom16(b), true
+	}
+
+	return netip.Addr{}, false
+}
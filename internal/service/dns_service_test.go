@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/netip"
+	"testing"
+	"time"
+
+	stdnet "net"
+
+	"github.com/miekg/dns"
+	"github.com/noisysockets/network"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrFromReverseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"2.0.64.100.in-addr.arpa.", "100.64.0.2"},
+		// Not fully qualified.
+		{"2.0.64.100.in-addr.arpa", "100.64.0.2"},
+		{"2.0.64.100.IN-ADDR.ARPA.", "100.64.0.2"},
+		{"2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", "fd00::2"},
+		{"F.E.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.B.D.0.1.0.0.2.IP6.ARPA.", "2001:db8::ef"},
+		// Too few octets.
+		{"0.64.100.in-addr.arpa.", ""},
+		{"in-addr.arpa.", ""},
+		// Too many octets.
+		{"1.2.0.64.100.in-addr.arpa.", ""},
+		// Invalid octets.
+		{"2..64.100.in-addr.arpa.", ""},
+		{"256.0.64.100.in-addr.arpa.", ""},
+		{"02.0.64.100.in-addr.arpa.", ""},
+		{"a.0.64.100.in-addr.arpa.", ""},
+		// Too few nibbles.
+		{"2.0.0.0.d.f.ip6.arpa.", ""},
+		{"0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", ""},
+		// Too many nibbles.
+		{"1.2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", ""},
+		// Nibbles must be single hex digits.
+		{"20.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.fd.ip6.arpa.", ""},
+		{"g.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", ""},
+		{"example.com.", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, ok := addrFromReverseName(tt.name)
+			if tt.expected == "" {
+				require.False(t, ok)
+				return
+			}
+
+			require.True(t, ok)
+			require.Equal(t, netip.MustParseAddr(tt.expected), addr)
+		})
+	}
+}
+
+func TestDNSReverseLookup(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	lis, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenAddr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := DNS(logger, &DNSServiceConfig{
+		Hosts: map[netip.Addr]string{
+			netip.MustParseAddr("100.64.0.2"): "peer1",
+			netip.MustParseAddr("fd00::2"):    "peer1",
+		},
+		DisableNetworkListener: true,
+		HostNet:                network.Host(),
+		HostListenAddrs:        []string{listenAddr},
+	})
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, &domainNetwork{Network: network.Host(), domain: "my.nzzy.net."})
+	}()
+
+	client := &dns.Client{Timeout: time.Second}
+
+	exchange := func(t *testing.T, name string, qtype uint16, recursive bool) *dns.Msg {
+		req := &dns.Msg{}
+		req.SetQuestion(name, qtype)
+		req.RecursionDesired = recursive
+
+		var reply *dns.Msg
+		require.Eventually(t, func() bool {
+			var err error
+			reply, _, err = client.Exchange(req, listenAddr)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+
+		return reply
+	}
+
+	t.Run("IPv4", func(t *testing.T) {
+		reply := exchange(t, "2.0.64.100.in-addr.arpa.", dns.TypePTR, true)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+		require.True(t, reply.Authoritative)
+
+		require.Len(t, reply.Answer, 1)
+		require.Equal(t, "peer1.my.nzzy.net.", reply.Answer[0].(*dns.PTR).Ptr)
+	})
+
+	t.Run("IPv6", func(t *testing.T) {
+		name := "2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.D.F.IP6.ARPA."
+
+		reply := exchange(t, name, dns.TypePTR, true)
+		require.Equal(t, dns.RcodeSuccess, reply.Rcode)
+
+		require.Len(t, reply.Answer, 1)
+		require.Equal(t, name, reply.Answer[0].Header().Name)
+		require.Equal(t, "peer1.my.nzzy.net.", reply.Answer[0].(*dns.PTR).Ptr)
+	})
+
+	t.Run("Malformed Name", func(t *testing.T) {
+		reply := exchange(t, "0.64.100.in-addr.arpa.", dns.TypePTR, true)
+		require.Equal(t, dns.RcodeNameError, reply.Rcode)
+	})
+
+	t.Run("Unsupported Type", func(t *testing.T) {
+		reply := exchange(t, "2.0.64.100.in-addr.arpa.", dns.TypeA, true)
+		require.Equal(t, dns.RcodeNotImplemented, reply.Rcode)
+	})
+
+	t.Run("Unknown Host", func(t *testing.T) {
+		// Without recursion, there's no one else to ask.
+		reply := exchange(t, "3.0.64.100.in-addr.arpa.", dns.TypePTR, false)
+		require.Equal(t, dns.RcodeRefused, reply.Rcode)
+	})
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+// domainNetwork overrides the domain of a network.
+type domainNetwork struct {
+	network.Network
+	domain string
+}
+
+func (n *domainNetwork) Domain() (string, error) {
+	return n.domain, nil
+}
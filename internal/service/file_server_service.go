@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	"golang.org/x/sync/errgroup"
+)
+
+var _ Service = (*FileServerService)(nil)
+
+// FileServerService is a HTTP server that listens on the WireGuard network
+// and serves the contents of a directory on the host. Directory listings and
+// range requests are supported. Uploads (using PUT requests) are optional.
+type FileServerService struct {
+	logger     *slog.Logger
+	listenAddr string
+	dir        string
+	upload     bool
+	acl        *AccessList
+}
+
+// FileServer returns a new file server service that listens on the given
+// WireGuard network address. Requests are only accepted from addresses
+// allowed by the access list (if any).
+func FileServer(logger *slog.Logger, listenAddr, dir string, upload bool, acl *AccessList) *FileServerService {
+	return &FileServerService{
+		logger:     logger,
+		listenAddr: listenAddr,
+		dir:        dir,
+		upload:     upload,
+		acl:        acl,
+	}
+}
+
+func (s *FileServerService) Serve(ctx context.Context, net network.Network) error {
+	lis, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer lis.Close()
+
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 30 * time.Second,
+		BaseContext: func(stdnet.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	s.logger.Info("Serving files",
+		slog.Any("urls", listenURLs(net, s.listenAddr, lis.Addr())), slog.String("dir", s.dir), slog.Bool("upload", s.upload))
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	})
+
+	g.Go(func() error {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
+
+// Handler returns the HTTP handler used to serve (and optionally upload) files,
+// enforcing the access list.
+func (s *FileServerService) Handler() http.Handler {
+	fileServer := http.FileServer(http.Dir(s.dir))
+
+	allowedMethods := "GET, HEAD"
+	if s.upload {
+		allowedMethods += ", PUT"
+	}
+
+	return s.acl.Middleware(s.logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			fileServer.ServeHTTP(w, r)
+		case http.MethodPut:
+			if s.upload {
+				s.handleUpload(w, r)
+				return
+			}
+			fallthrough
+		default:
+			w.Header().Set("Allow", allowedMethods)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func (s *FileServerService) handleUpload(w http.ResponseWriter, r *http.Request) {
+	// Cleaning a rooted path removes any ".." elements, so the resulting
+	// path will always be within the served directory.
+	name := path.Clean("/" + r.URL.Path)
+	if name == "/" || strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Upload path must name a file", http.StatusBadRequest)
+		return
+	}
+
+	logger := s.logger.With(slog.String("remoteAddr", r.RemoteAddr), slog.String("path", name))
+
+	dst := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := writeFileAtomic(dst, r.Body); err != nil {
+		logger.Warn("Failed to upload file", slog.Any("error", err))
+
+		http.Error(w, "Failed to upload file", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Uploaded file")
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// writeFileAtomic writes the contents of r to a temporary file and then
+// renames it into place, so partial uploads are never visible.
+func writeFileAtomic(dst string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	return nil
+}
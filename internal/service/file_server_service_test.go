@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("Hello, world!"), 0o644))
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("Range", func(t *testing.T) {
+		srv := httptest.NewServer(service.FileServer(logger, "", dir, false, nil).Handler())
+		t.Cleanup(srv.Close)
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/hello.txt", nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", "bytes=7-11")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "world", string(body))
+	})
+
+	t.Run("Read Only", func(t *testing.T) {
+		srv := httptest.NewServer(service.FileServer(logger, "", dir, false, nil).Handler())
+		t.Cleanup(srv.Close)
+
+		resp := put(t, srv.URL+"/upload.txt", "data")
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+		require.NoFileExists(t, filepath.Join(dir, "upload.txt"))
+	})
+
+	t.Run("Upload", func(t *testing.T) {
+		srv := httptest.NewServer(service.FileServer(logger, "", dir, true, nil).Handler())
+		t.Cleanup(srv.Close)
+
+		resp := put(t, srv.URL+"/sub/upload.txt", "data")
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		data, err := os.ReadFile(filepath.Join(dir, "sub", "upload.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "data", string(data))
+
+		// Paths are cleaned, so uploads can't escape the served directory.
+		resp = put(t, srv.URL+"/../../escape.txt", "data")
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		require.FileExists(t, filepath.Join(dir, "escape.txt"))
+		require.NoFileExists(t, filepath.Join(filepath.Dir(dir), "escape.txt"))
+
+		resp = put(t, srv.URL+"/sub/", "data")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func put(t *testing.T, url, body string) *http.Response {
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(body))
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+)
+
+var _ Service = (*ForwardService)(nil)
+
+// ForwardDirection is the direction in which connections are forwarded.
+type ForwardDirection string
+
+const (
+	// ForwardLocal listens on the host network and forwards connections to
+	// the WireGuard network.
+	ForwardLocal ForwardDirection = "local"
+	// ForwardRemote listens on the WireGuard network and forwards connections
+	// to the host network.
+	ForwardRemote ForwardDirection = "remote"
+)
+
+// ForwardService is a service that forwards TCP connections (or UDP flows)
+// between the host network and the WireGuard network.
+type ForwardService struct {
+	logger     *slog.Logger
+	hostNet    network.Network
+	direction  ForwardDirection
+	protocol   string
+	listenAddr string
+	dialAddr   string
+}
+
+// Forward returns a service that forwards TCP connections (or UDP flows)
+// received on the listen address to the dial address, in the given direction.
+// The protocol is either "tcp" or "udp". For tcp, the address on the host
+// network can also be the path of a Unix socket.
+func Forward(logger *slog.Logger, hostNet network.Network, direction ForwardDirection, protocol, listenAddr, dialAddr string) *ForwardService {
+	return &ForwardService{
+		logger:     logger,
+		hostNet:    hostNet,
+		direction:  direction,
+		protocol:   protocol,
+		listenAddr: listenAddr,
+		dialAddr:   dialAddr,
+	}
+}
+
+func (s *ForwardService) Serve(ctx context.Context, net network.Network) error {
+	listenNet, dialNet := s.hostNet, net
+	if s.direction == ForwardRemote {
+		listenNet, dialNet = net, s.hostNet
+	}
+
+	switch s.protocol {
+	case "tcp":
+	case "udp":
+		return s.serveUDP(ctx, listenNet, dialNet)
+	default:
+		return fmt.Errorf("unsupported protocol %q", s.protocol)
+	}
+
+	lis, err := listenNet.Listen(addrNetwork(s.listenAddr), s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer lis.Close()
+
+	// Only the current user should be able to connect to the socket.
+	if IsUnixSocket(s.listenAddr) {
+		if err := os.Chmod(s.listenAddr, 0o600); err != nil {
+			return fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+
+	logger := s.logger.With(
+		slog.String("direction", string(s.direction)),
+		slog.Any("listenAddrs", listenAddrs(listenNet, s.listenAddr, lis.Addr())),
+		slog.String("dialAddr", s.dialAddr))
+
+	logger.Info("Forwarding connections")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger := logger.With(slog.String("remoteAddr", conn.RemoteAddr().String()))
+
+			if err := s.forward(ctx, logger, dialNet, conn); err != nil {
+				logger.Warn("Failed to forward connection", slog.Any("error", err))
+			}
+		}()
+	}
+}
+
+func (s *ForwardService) forward(ctx context.Context, logger *slog.Logger, dialNet network.Network, conn stdnet.Conn) error {
+	defer conn.Close()
+
+	logger.Debug("Accepted connection")
+
+	upstreamConn, err := dialNet.DialContext(ctx, addrNetwork(s.dialAddr), s.dialAddr)
+	if err != nil {
+		return fmt.Errorf("failed to dial %s: %w", s.dialAddr, err)
+	}
+	defer upstreamConn.Close()
+
+	// Make sure we don't hang around after being asked to shutdown.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			_ = upstreamConn.Close()
+		case <-done:
+		}
+	}()
+
+	if err := Splice(conn, upstreamConn); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	logger.Debug("Connection closed")
+
+	return nil
+}
+
+// Splice copies data between the two connections until both directions
+// have been closed.
+func Splice(a, b stdnet.Conn) error {
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+
+	copyConn := func(i int, dst, src stdnet.Conn) {
+		defer wg.Done()
+
+		_, err := io.Copy(dst, src)
+		if err != nil && !errors.Is(err, stdnet.ErrClosed) {
+			errs[i] = err
+		}
+
+		// Propagate the half close (if supported).
+		if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = cw.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go copyConn(0, a, b)
+	go copyConn(1, b, a)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// IsUnixSocket returns whether the address is the path of a Unix socket
+// (rather than a host:port).
+func IsUnixSocket(addr string) bool {
+	return filepath.IsAbs(addr)
+}
+
+func addrNetwork(addr string) string {
+	if IsUnixSocket(addr) {
+		return "unix"
+	}
+
+	return "tcp"
+}
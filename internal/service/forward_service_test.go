@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/network"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardUDP(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A simple UDP echo server.
+	echo, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = echo.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := echo.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			_, _ = echo.WriteTo(buf[:n], addr)
+		}
+	}()
+
+	// Find a free port to forward from.
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listenAddr := pc.LocalAddr().String()
+	require.NoError(t, pc.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := service.Forward(logger, network.Host(), service.ForwardLocal, "udp", listenAddr, echo.LocalAddr().String())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, network.Host())
+	}()
+
+	// Each client is a separate flow.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("udp", listenAddr)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+
+		buf := make([]byte, 1500)
+		require.Eventually(t, func() bool {
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				return false
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			n, err := conn.Read(buf)
+			return err == nil && string(buf[:n]) == "hello"
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestForwardUnixSocket(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// A simple TCP echo server.
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = echo.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	socketPath := filepath.Join(t.TempDir(), "forward.sock")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := service.Forward(logger, network.Host(), service.ForwardLocal, "tcp", socketPath, echo.Addr().String())
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, network.Host())
+	}()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		conn, err = net.Dial("unix", socketPath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(buf))
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
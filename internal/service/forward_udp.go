@@ -0,0 +1,184 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+)
+
+// udpIdleTimeout is how long a UDP flow can go without any packets in either
+// direction before it is forgotten (similar to conntrack on Linux).
+const udpIdleTimeout = 2 * time.Minute
+
+// The largest possible UDP payload.
+const maxUDPPacketSize = 65535
+
+// udpFlow is a UDP "connection" between a client and the upstream, each
+// client is given its own upstream socket so replies can be told apart.
+type udpFlow struct {
+	upstreamConn stdnet.Conn
+	mu           sync.Mutex
+	lastActive   time.Time
+}
+
+func (f *udpFlow) touch() {
+	f.mu.Lock()
+	f.lastActive = time.Now()
+	f.mu.Unlock()
+}
+
+func (f *udpFlow) idleSince() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lastActive
+}
+
+func (s *ForwardService) serveUDP(ctx context.Context, listenNet, dialNet network.Network) error {
+	pc, err := listenNet.ListenPacket("udp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer pc.Close()
+
+	logger := s.logger.With(
+		slog.String("direction", string(s.direction)),
+		slog.String("protocol", "udp"),
+		slog.Any("listenAddrs", listenAddrs(listenNet, s.listenAddr, pc.LocalAddr())),
+		slog.String("dialAddr", s.dialAddr))
+
+	logger.Info("Forwarding packets")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	flows := make(map[string]*udpFlow)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	// Close the listener and all of the flows when shutting down.
+	go func() {
+		<-ctx.Done()
+		_ = pc.Close()
+
+		mu.Lock()
+		for _, flow := range flows {
+			_ = flow.upstreamConn.Close()
+		}
+		mu.Unlock()
+	}()
+
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, clientAddr, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to read packet: %w", err)
+		}
+
+		mu.Lock()
+		flow, ok := flows[clientAddr.String()]
+		if !ok {
+			upstreamConn, err := dialNet.DialContext(ctx, "udp", s.dialAddr)
+			if err != nil {
+				mu.Unlock()
+
+				logger.Warn("Failed to dial upstream",
+					slog.String("remoteAddr", clientAddr.String()), slog.Any("error", err))
+				continue
+			}
+
+			flow = &udpFlow{upstreamConn: upstreamConn, lastActive: time.Now()}
+			flows[clientAddr.String()] = flow
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				logger := logger.With(slog.String("remoteAddr", clientAddr.String()))
+
+				logger.Debug("New flow")
+
+				if err := s.replyUDP(ctx, pc, clientAddr, flow); err != nil {
+					logger.Warn("Failed to forward replies", slog.Any("error", err))
+				}
+
+				mu.Lock()
+				delete(flows, clientAddr.String())
+				mu.Unlock()
+
+				_ = flow.upstreamConn.Close()
+
+				logger.Debug("Flow closed")
+			}()
+		}
+		mu.Unlock()
+
+		flow.touch()
+
+		if _, err := flow.upstreamConn.Write(buf[:n]); err != nil && ctx.Err() == nil {
+			logger.Debug("Failed to write packet",
+				slog.String("remoteAddr", clientAddr.String()), slog.Any("error", err))
+		}
+	}
+}
+
+// replyUDP copies packets from the upstream back to the client, until the
+// flow has been idle for longer than the timeout.
+func (s *ForwardService) replyUDP(ctx context.Context, pc stdnet.PacketConn, clientAddr stdnet.Addr, flow *udpFlow) error {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		if err := flow.upstreamConn.SetReadDeadline(flow.idleSince().Add(udpIdleTimeout)); err != nil {
+			return err
+		}
+
+		n, err := flow.upstreamConn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, stdnet.ErrClosed) {
+				return nil
+			}
+
+			var netErr stdnet.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				// The client may have sent packets while we were waiting.
+				if time.Since(flow.idleSince()) < udpIdleTimeout {
+					continue
+				}
+
+				return nil
+			}
+
+			return fmt.Errorf("failed to read packet: %w", err)
+		}
+
+		flow.touch()
+
+		if _, err := pc.WriteTo(buf[:n], clientAddr); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to write packet: %w", err)
+		}
+	}
+}
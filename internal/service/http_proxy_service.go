@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"sync"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	"golang.org/x/sync/errgroup"
+)
+
+var _ Service = (*HTTPProxyService)(nil)
+
+// HTTPProxyService is a HTTP forward proxy server that listens on the host
+// network and dials connections through the WireGuard network. CONNECT
+// requests are supported for tunneling TLS (and other TCP) connections.
+type HTTPProxyService struct {
+	logger     *slog.Logger
+	hostNet    network.Network
+	listenAddr string
+}
+
+// HTTPProxy returns a new HTTP proxy service that listens on the given host
+// network address.
+func HTTPProxy(logger *slog.Logger, hostNet network.Network, listenAddr string) *HTTPProxyService {
+	return &HTTPProxyService{
+		logger:     logger,
+		hostNet:    hostNet,
+		listenAddr: listenAddr,
+	}
+}
+
+func (s *HTTPProxyService) Serve(ctx context.Context, net network.Network) error {
+	lis, err := s.hostNet.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer lis.Close()
+
+	s.logger.Info("Listening for HTTP proxy connections", slog.String("address", lis.Addr().String()))
+
+	transport := &http.Transport{
+		DialContext:         net.DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+
+	// Request URLs are absolute so can be forwarded as is.
+	reverseProxy := &httputil.ReverseProxy{
+		Rewrite:   func(*httputil.ProxyRequest) {},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			s.logger.Warn("Failed to proxy request",
+				slog.String("remoteAddr", r.RemoteAddr), slog.String("url", r.URL.String()), slog.Any("error", err))
+
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	// Tunnels are hijacked from the HTTP server, so we need to track them
+	// ourselves.
+	var tunnels sync.WaitGroup
+	defer tunnels.Wait()
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			logger := s.logger.With(slog.String("remoteAddr", r.RemoteAddr))
+
+			if r.Method == http.MethodConnect {
+				tunnels.Add(1)
+				defer tunnels.Done()
+
+				if err := s.tunnel(ctx, logger, net, w, r); err != nil {
+					logger.Warn("Failed to tunnel connection", slog.String("address", r.Host), slog.Any("error", err))
+				}
+
+				return
+			}
+
+			if !r.URL.IsAbs() {
+				http.Error(w, "This is a proxy server, requests must use an absolute URL", http.StatusBadRequest)
+				return
+			}
+
+			logger.Debug("Proxying request", slog.String("method", r.Method), slog.String("url", r.URL.String()))
+
+			reverseProxy.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 30 * time.Second,
+	}
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	})
+
+	g.Go(func() error {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
+
+func (s *HTTPProxyService) tunnel(ctx context.Context, logger *slog.Logger, net network.Network, w http.ResponseWriter, r *http.Request) error {
+	logger = logger.With(slog.String("address", r.Host))
+
+	logger.Debug("Dialing")
+
+	upstreamConn, err := net.DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return fmt.Errorf("failed to dial: %w", err)
+	}
+	defer upstreamConn.Close()
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return fmt.Errorf("failed to hijack connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		return fmt.Errorf("failed to write response: %w", err)
+	}
+
+	// The server may have set deadlines on the connection, clear them.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("failed to clear deadline: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			_ = upstreamConn.Close()
+		case <-done:
+		}
+	}()
+
+	// Any data the client sent early will be buffered in the reader.
+	if buffered := rw.Reader.Buffered(); buffered > 0 {
+		data, _ := rw.Reader.Peek(buffered)
+		if _, err := upstreamConn.Write(data); err != nil {
+			return fmt.Errorf("failed to write buffered data: %w", err)
+		}
+	}
+
+	if err := Splice(conn, upstreamConn); err != nil && !errors.Is(err, stdnet.ErrClosed) && ctx.Err() == nil {
+		return err
+	}
+
+	logger.Debug("Connection closed")
+
+	return nil
+}
@@ -0,0 +1,229 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/network"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPProxy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reflect the request headers, so the test can check what was forwarded.
+		for _, name := range []string{"X-Forwarded", "X-Secret", "Proxy-Authorization", "Keep-Alive", "Te"} {
+			if value := r.Header.Get(name); value != "" {
+				w.Header().Set("Echo-"+name, value)
+			}
+		}
+
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("X-Upstream", "1")
+
+		_, _ = io.WriteString(w, r.Method+" "+r.Host+r.URL.Path)
+	}))
+	t.Cleanup(upstream.Close)
+
+	httpNet := &fakeDialNetwork{
+		Network:    network.Host(),
+		targetAddr: upstream.Listener.Addr().String(),
+	}
+
+	listenAddr := freeTCPAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := service.HTTPProxy(logger, network.Host(), listenAddr)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, httpNet)
+	}()
+
+	require.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", listenAddr)
+		if err != nil {
+			return false
+		}
+		_ = conn.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: listenAddr}),
+		},
+		Timeout: 5 * time.Second,
+	}
+	t.Cleanup(client.CloseIdleConnections)
+
+	t.Run("Forward", func(t *testing.T) {
+		resp, err := client.Get("http://peer1.test/hello")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "GET peer1.test/hello", string(body))
+
+		require.Equal(t, "peer1.test:80", httpNet.lastDialed())
+	})
+
+	t.Run("Hop-by-hop Headers", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "http://peer1.test/", nil)
+		require.NoError(t, err)
+
+		req.Header.Set("Connection", "X-Secret")
+		req.Header.Set("X-Secret", "1")
+		req.Header.Set("Keep-Alive", "timeout=5")
+		req.Header.Set("Te", "gzip")
+		req.Header.Set("X-Forwarded", "1")
+
+		// The client transport adds Proxy-Authorization from the proxy URL.
+		client := &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyURL(&url.URL{Scheme: "http", Host: listenAddr, User: url.UserPassword("user", "pass")}),
+			},
+			Timeout: 5 * time.Second,
+		}
+		t.Cleanup(client.CloseIdleConnections)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = resp.Body.Close()
+		})
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// End-to-end headers are forwarded.
+		require.Equal(t, "1", resp.Header.Get("Echo-X-Forwarded"))
+		require.Equal(t, "1", resp.Header.Get("X-Upstream"))
+
+		// But hop-by-hop headers are not, in either direction.
+		require.Empty(t, resp.Header.Get("Echo-X-Secret"))
+		require.Empty(t, resp.Header.Get("Echo-Proxy-Authorization"))
+		require.Empty(t, resp.Header.Get("Echo-Keep-Alive"))
+		require.Empty(t, resp.Header.Get("Echo-Te"))
+		require.Empty(t, resp.Header.Get("X-Upstream-Hop"))
+	})
+
+	t.Run("Relative URL", func(t *testing.T) {
+		// Sent directly, as if to an origin server (ignoring any proxy environment variables).
+		direct := &http.Client{Transport: &http.Transport{}, Timeout: 5 * time.Second}
+		t.Cleanup(direct.CloseIdleConnections)
+
+		resp, err := direct.Get("http://" + listenAddr + "/hello")
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+func TestHTTPProxyConnect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tunnelNet := &fakeDialNetwork{
+		Network:    network.Host(),
+		targetAddr: startEchoServer(t),
+		errors: map[string]error{
+			"refused.test:443": errors.New("connection was refused"),
+		},
+	}
+
+	listenAddr := freeTCPAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := service.HTTPProxy(logger, network.Host(), listenAddr)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, tunnelNet)
+	}()
+
+	connect := func(t *testing.T, address, earlyData string) (net.Conn, *bufio.Reader, *http.Response) {
+		var conn net.Conn
+		require.Eventually(t, func() bool {
+			var err error
+			conn, err = net.Dial("tcp", listenAddr)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		_, err := io.WriteString(conn, "CONNECT "+address+" HTTP/1.1\r\nHost: "+address+"\r\n\r\n"+earlyData)
+		require.NoError(t, err)
+
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, &http.Request{Method: http.MethodConnect})
+		require.NoError(t, err)
+
+		return conn, br, resp
+	}
+
+	t.Run("Tunnel", func(t *testing.T) {
+		// Data sent before the response is received should still be tunneled.
+		conn, br, resp := connect(t, "peer1.test:443", "hello")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.Equal(t, "peer1.test:443", tunnelNet.lastDialed())
+
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(br, buf)
+		require.NoError(t, err)
+		require.Equal(t, "hello", string(buf))
+
+		_, err = conn.Write([]byte("world"))
+		require.NoError(t, err)
+
+		_, err = io.ReadFull(br, buf)
+		require.NoError(t, err)
+		require.Equal(t, "world", string(buf))
+	})
+
+	t.Run("Dial Error", func(t *testing.T) {
+		_, _, resp := connect(t, "refused.test:443", "")
+		_ = resp.Body.Close()
+
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
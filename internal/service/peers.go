@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"sync"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/noisysockets/types"
+)
+
+// PeerManager adds and removes peers on an open network. The set of peers
+// (and the configured peers) may also be changed by others, eg. when the
+// configuration is reloaded, so the lock must be held while reading or
+// changing them.
+type PeerManager interface {
+	sync.Locker
+	AddPeer(peerConf latestconfig.PeerConfig) error
+	RemovePeer(publicKey types.NoisePublicKey)
+}
+
+type peerManagerKey struct{}
+
+// WithPeerManager returns a context that allows services to add and remove
+// peers on the network they are serving.
+func WithPeerManager(ctx context.Context, pm PeerManager) context.Context {
+	return context.WithValue(ctx, peerManagerKey{}, pm)
+}
+
+func peerManagerFromContext(ctx context.Context) (PeerManager, bool) {
+	pm, ok := ctx.Value(peerManagerKey{}).(PeerManager)
+	return pm, ok
+}
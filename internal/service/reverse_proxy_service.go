@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/network"
+	"golang.org/x/sync/errgroup"
+)
+
+var _ Service = (*ReverseProxyService)(nil)
+
+// ReverseProxyUpstream maps a path prefix to an upstream HTTP server.
+type ReverseProxyUpstream struct {
+	// Path is the path prefix that is forwarded to the upstream, the prefix
+	// is stripped from the request path.
+	Path string
+	// URL is the base URL of the upstream.
+	URL *url.URL
+}
+
+// ReverseProxyService is a HTTP reverse proxy that listens on the WireGuard
+// network and forwards requests to upstream servers on the host network.
+type ReverseProxyService struct {
+	logger     *slog.Logger
+	hostNet    network.Network
+	listenAddr string
+	upstreams  []ReverseProxyUpstream
+	acl        *AccessList
+}
+
+// ReverseProxy returns a new reverse proxy service that listens on the given
+// WireGuard network address. Requests are only accepted from addresses
+// allowed by the access list (if any).
+func ReverseProxy(logger *slog.Logger, hostNet network.Network, listenAddr string,
+	upstreams []ReverseProxyUpstream, acl *AccessList) *ReverseProxyService {
+	return &ReverseProxyService{
+		logger:     logger,
+		hostNet:    hostNet,
+		listenAddr: listenAddr,
+		upstreams:  upstreams,
+		acl:        acl,
+	}
+}
+
+func (s *ReverseProxyService) Serve(ctx context.Context, net network.Network) error {
+	lis, err := net.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer lis.Close()
+
+	transport := &http.Transport{
+		DialContext:         s.hostNet.DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	defer transport.CloseIdleConnections()
+
+	mux := http.NewServeMux()
+
+	for _, upstream := range s.upstreams {
+		prefix := strings.TrimSuffix(upstream.Path, "/")
+
+		logger := s.logger.With(slog.String("path", prefix+"/"), slog.String("upstream", upstream.URL.String()))
+
+		reverseProxy := &httputil.ReverseProxy{
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.Out.URL.Path = strings.TrimPrefix(r.In.URL.Path, prefix)
+				r.Out.URL.RawPath = strings.TrimPrefix(r.In.URL.RawPath, prefix)
+
+				r.SetURL(upstream.URL)
+				r.SetXForwarded()
+				r.Out.Host = r.In.Host
+			},
+			Transport: transport,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				logger.Warn("Failed to proxy request",
+					slog.String("remoteAddr", r.RemoteAddr), slog.String("url", r.URL.String()), slog.Any("error", err))
+
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		}
+
+		mux.Handle(prefix+"/", reverseProxy)
+
+		logger.Info("Proxying requests")
+	}
+
+	srv := &http.Server{
+		Handler:           s.acl.Middleware(s.logger, mux),
+		ReadHeaderTimeout: 30 * time.Second,
+		BaseContext: func(stdnet.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	s.logger.Info("Listening for HTTP connections", slog.Any("urls", listenURLs(net, s.listenAddr, lis.Addr())))
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return srv.Shutdown(shutdownCtx)
+	})
+
+	g.Go(func() error {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("failed to serve: %w", err)
+		}
+
+		return nil
+	})
+
+	return g.Wait()
+}
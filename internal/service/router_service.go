@@ -25,33 +25,42 @@ var _ Service = (*RouterService)(nil)
 // RouterService is a service that forwards packets from the source network to
 // the destination network and vice versa.
 type RouterService struct {
-	logger      *slog.Logger
-	dstNet      network.Network
-	enableNAT64 bool
-	nat64Prefix netip.Prefix
+	logger              *slog.Logger
+	dstNet              network.Network
+	allowedDestinations []netip.Prefix
+	enableNAT64         bool
+	nat64Prefix         netip.Prefix
 }
 
 // Router returns a service that forwards packets from the source network to
-// the destination network and vice versa.
-func Router(logger *slog.Logger, dstNet network.Network, enableNAT64 bool, nat64Prefix netip.Prefix) *RouterService {
+// the destination network and vice versa. Only packets addressed to the
+// allowed destinations will be forwarded, if none are provided then packets
+// to any destination will be forwarded.
+func Router(logger *slog.Logger, dstNet network.Network, allowedDestinations []netip.Prefix,
+	enableNAT64 bool, nat64Prefix netip.Prefix) *RouterService {
+	if len(allowedDestinations) == 0 {
+		allowedDestinations = []netip.Prefix{
+			netip.MustParsePrefix("0.0.0.0/0"),
+			netip.MustParsePrefix("::/0"),
+		}
+	}
+
 	return &RouterService{
-		logger:      logger,
-		dstNet:      dstNet,
-		enableNAT64: enableNAT64,
-		nat64Prefix: nat64Prefix,
+		logger:              logger,
+		dstNet:              dstNet,
+		allowedDestinations: allowedDestinations,
+		enableNAT64:         enableNAT64,
+		nat64Prefix:         nat64Prefix,
 	}
 }
 
 func (s *RouterService) Serve(ctx context.Context, net network.Network) error {
-	s.logger.Info("Enabling packet forwarding")
+	s.logger.Info("Enabling packet forwarding", slog.Any("allowedDestinations", s.allowedDestinations))
 
 	fwdConf := forwarder.ForwarderConfig{
-		AllowedDestinations: []netip.Prefix{
-			netip.MustParsePrefix("0.0.0.0/0"),
-			netip.MustParsePrefix("::/0"),
-		},
-		EnableNAT64: &s.enableNAT64,
-		NAT64Prefix: &s.nat64Prefix,
+		AllowedDestinations: s.allowedDestinations,
+		EnableNAT64:         &s.enableNAT64,
+		NAT64Prefix:         &s.nat64Prefix,
 	}
 
 	userspaceNet := net.(*noisysockets.NoisySocketsNetwork).UserspaceNetwork
@@ -0,0 +1,328 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	stdnet "net"
+
+	"github.com/noisysockets/netstack/pkg/tcpip"
+	"github.com/noisysockets/network"
+)
+
+var _ Service = (*SOCKS5Service)(nil)
+
+const (
+	socks5Version = 0x05
+
+	socks5AuthNone         = 0x00
+	socks5AuthNoAcceptable = 0xFF
+
+	socks5CmdConnect = 0x01
+
+	socks5AddrIPv4   = 0x01
+	socks5AddrDomain = 0x03
+	socks5AddrIPv6   = 0x04
+
+	socks5ReplySucceeded           = 0x00
+	socks5ReplyGeneralFailure      = 0x01
+	socks5ReplyNetworkUnreachable  = 0x03
+	socks5ReplyHostUnreachable     = 0x04
+	socks5ReplyConnectionRefused   = 0x05
+	socks5ReplyCommandNotSupported = 0x07
+	socks5ReplyAddrNotSupported    = 0x08
+
+	// How long a client has to complete the SOCKS handshake.
+	socks5HandshakeTimeout = 30 * time.Second
+)
+
+// SOCKS5Service is a SOCKS5 proxy server that listens on the host network and
+// dials connections through the WireGuard network. Only the CONNECT command,
+// without authentication, is supported.
+type SOCKS5Service struct {
+	logger     *slog.Logger
+	hostNet    network.Network
+	listenAddr string
+}
+
+// SOCKS5 returns a new SOCKS5 proxy service that listens on the given host
+// network address.
+func SOCKS5(logger *slog.Logger, hostNet network.Network, listenAddr string) *SOCKS5Service {
+	return &SOCKS5Service{
+		logger:     logger,
+		hostNet:    hostNet,
+		listenAddr: listenAddr,
+	}
+}
+
+func (s *SOCKS5Service) Serve(ctx context.Context, net network.Network) error {
+	lis, err := s.hostNet.Listen("tcp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	defer lis.Close()
+
+	s.logger.Info("Listening for SOCKS5 connections", slog.String("address", lis.Addr().String()))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = lis.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			logger := s.logger.With(slog.String("remoteAddr", conn.RemoteAddr().String()))
+
+			if err := s.handle(ctx, logger, net, conn); err != nil {
+				logger.Warn("Failed to proxy connection", slog.Any("error", err))
+			}
+		}()
+	}
+}
+
+func (s *SOCKS5Service) handle(ctx context.Context, logger *slog.Logger, net network.Network, conn stdnet.Conn) error {
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(socks5HandshakeTimeout)); err != nil {
+		return fmt.Errorf("failed to set handshake deadline: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+
+	if err := socks5Negotiate(r, conn); err != nil {
+		return fmt.Errorf("failed to negotiate authentication: %w", err)
+	}
+
+	address, reply, err := socks5ReadRequest(r)
+	if err != nil {
+		if reply != socks5ReplySucceeded {
+			_ = socks5WriteReply(conn, reply, nil)
+		}
+
+		return fmt.Errorf("failed to read request: %w", err)
+	}
+
+	logger = logger.With(slog.String("address", address))
+
+	logger.Debug("Dialing")
+
+	upstreamConn, err := net.DialContext(ctx, "tcp", address)
+	if err != nil {
+		_ = socks5WriteReply(conn, socks5DialErrorReply(err), nil)
+		return fmt.Errorf("failed to dial %s: %w", address, err)
+	}
+	defer upstreamConn.Close()
+
+	if err := socks5WriteReply(conn, socks5ReplySucceeded, upstreamConn.LocalAddr()); err != nil {
+		return fmt.Errorf("failed to write reply: %w", err)
+	}
+
+	// Handshake complete.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("failed to clear handshake deadline: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+			_ = upstreamConn.Close()
+		case <-done:
+		}
+	}()
+
+	// Any data the client sent early will be buffered in the reader.
+	if buffered := r.Buffered(); buffered > 0 {
+		data, _ := r.Peek(buffered)
+		if _, err := upstreamConn.Write(data); err != nil {
+			return fmt.Errorf("failed to write buffered data: %w", err)
+		}
+	}
+
+	if err := Splice(conn, upstreamConn); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	logger.Debug("Connection closed")
+
+	return nil
+}
+
+func socks5Negotiate(r *bufio.Reader, w io.Writer) error {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+
+	if header[0] != socks5Version {
+		return fmt.Errorf("unsupported SOCKS version: %d", header[0])
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(r, methods); err != nil {
+		return err
+	}
+
+	for _, method := range methods {
+		if method == socks5AuthNone {
+			_, err := w.Write([]byte{socks5Version, socks5AuthNone})
+			return err
+		}
+	}
+
+	_, _ = w.Write([]byte{socks5Version, socks5AuthNoAcceptable})
+
+	return errors.New("no acceptable authentication methods")
+}
+
+// socks5ReadRequest reads a SOCKS5 request, returning the destination address.
+// If the request is not supported, a reply code is returned alongside the error.
+func socks5ReadRequest(r *bufio.Reader) (string, byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", socks5ReplySucceeded, err
+	}
+
+	if header[0] != socks5Version {
+		return "", socks5ReplySucceeded, fmt.Errorf("unsupported SOCKS version: %d", header[0])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5AddrIPv4, socks5AddrIPv6:
+		addrLen := 4
+		if header[3] == socks5AddrIPv6 {
+			addrLen = 16
+		}
+
+		addrBytes := make([]byte, addrLen)
+		if _, err := io.ReadFull(r, addrBytes); err != nil {
+			return "", socks5ReplySucceeded, err
+		}
+
+		addr, _ := netip.AddrFromSlice(addrBytes)
+		host = addr.String()
+	case socks5AddrDomain:
+		domainLen, err := r.ReadByte()
+		if err != nil {
+			return "", socks5ReplySucceeded, err
+		}
+
+		domain := make([]byte, domainLen)
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", socks5ReplySucceeded, err
+		}
+
+		host = string(domain)
+	default:
+		return "", socks5ReplyAddrNotSupported, fmt.Errorf("unsupported address type: %d", header[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(r, port[:]); err != nil {
+		return "", socks5ReplySucceeded, err
+	}
+
+	if header[1] != socks5CmdConnect {
+		return "", socks5ReplyCommandNotSupported, fmt.Errorf("unsupported command: %d", header[1])
+	}
+
+	return stdnet.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), socks5ReplySucceeded, nil
+}
+
+func socks5WriteReply(w io.Writer, reply byte, bindAddr stdnet.Addr) error {
+	addrPort := netip.AddrPortFrom(netip.IPv4Unspecified(), 0)
+	if bindAddr != nil {
+		if parsed, err := netip.ParseAddrPort(bindAddr.String()); err == nil {
+			addrPort = parsed
+		}
+	}
+
+	msg := []byte{socks5Version, reply, 0x00}
+
+	addr := addrPort.Addr().Unmap()
+	if addr.Is4() {
+		msg = append(msg, socks5AddrIPv4)
+	} else {
+		msg = append(msg, socks5AddrIPv6)
+	}
+
+	msg = append(msg, addr.AsSlice()...)
+	msg = binary.BigEndian.AppendUint16(msg, addrPort.Port())
+
+	_, err := w.Write(msg)
+	return err
+}
+
+// socks5DialErrorReply maps a dial error to the closest SOCKS5 reply code.
+func socks5DialErrorReply(err error) byte {
+	var dnsErr *stdnet.DNSError
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		isNetstackError(err, &tcpip.ErrConnectionRefused{}):
+		return socks5ReplyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH),
+		isNetstackError(err, &tcpip.ErrNetworkUnreachable{}):
+		return socks5ReplyNetworkUnreachable
+	case errors.As(err, &dnsErr),
+		errors.Is(err, syscall.EHOSTUNREACH),
+		isNetstackError(err, &tcpip.ErrHostUnreachable{}):
+		return socks5ReplyHostUnreachable
+	default:
+		return socks5ReplyGeneralFailure
+	}
+}
+
+// isNetstackError returns whether err was caused by the given userspace
+// network stack error. The stack only returns the message of the original
+// error, so the innermost error is compared against it.
+func isNetstackError(err error, target tcpip.Error) bool {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return err.Error() == target.String()
+		}
+
+		err = inner
+	}
+}
@@ -0,0 +1,302 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package service_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/network"
+	"github.com/noisysockets/nsh/internal/service"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSOCKS5(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	echoAddr := startEchoServer(t)
+
+	wgNet := &fakeDialNetwork{
+		Network:    network.Host(),
+		targetAddr: echoAddr,
+		errors: map[string]error{
+			"refused.test:80": &net.OpError{Op: "dial", Net: "tcp",
+				Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			"unreachable.test:80": &net.OpError{Op: "dial", Net: "tcp",
+				Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)},
+			"network-unreachable.test:80": &net.OpError{Op: "dial", Net: "tcp",
+				Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+			"unknown.test:80": &net.OpError{Op: "dial", Net: "tcp",
+				Err: &net.DNSError{Err: "no such host", Name: "unknown.test", IsNotFound: true}},
+			// The userspace network stack only returns the error message.
+			"netstack-refused.test:80": &net.OpError{Op: "dial", Net: "tcp",
+				Err: errors.New("connection was refused")},
+			"broken.test:80": errors.New("something went wrong"),
+		},
+	}
+
+	listenAddr := freeTCPAddr(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	s := service.SOCKS5(logger, network.Host(), listenAddr)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Serve(ctx, wgNet)
+	}()
+
+	dial := func(t *testing.T) net.Conn {
+		var conn net.Conn
+		require.Eventually(t, func() bool {
+			var err error
+			conn, err = net.Dial("tcp", listenAddr)
+			return err == nil
+		}, 5*time.Second, 10*time.Millisecond)
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+
+		require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+		return conn
+	}
+
+	// Negotiates no authentication, and sends a CONNECT request.
+	connect := func(t *testing.T, addrType byte, addr []byte, port uint16) (net.Conn, byte) {
+		conn := dial(t)
+
+		_, err := conn.Write([]byte{0x05, 0x01, 0x00})
+		require.NoError(t, err)
+
+		method := make([]byte, 2)
+		_, err = io.ReadFull(conn, method)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x05, 0x00}, method)
+
+		return conn, request(t, conn, 0x01, addrType, addr, port)
+	}
+
+	t.Run("Negotiation", func(t *testing.T) {
+		conn := dial(t)
+
+		// Username/password, and no authentication.
+		_, err := conn.Write([]byte{0x05, 0x02, 0x02, 0x00})
+		require.NoError(t, err)
+
+		method := make([]byte, 2)
+		_, err = io.ReadFull(conn, method)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x05, 0x00}, method)
+	})
+
+	t.Run("No Acceptable Authentication", func(t *testing.T) {
+		conn := dial(t)
+
+		// Only username/password.
+		_, err := conn.Write([]byte{0x05, 0x01, 0x02})
+		require.NoError(t, err)
+
+		method := make([]byte, 2)
+		_, err = io.ReadFull(conn, method)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x05, 0xFF}, method)
+
+		_, err = conn.Read(method)
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("Connect", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			addrType byte
+			addr     []byte
+			port     uint16
+			expected string
+		}{
+			{"IPv4", 0x01, netip.MustParseAddr("100.64.0.2").AsSlice(), 80, "100.64.0.2:80"},
+			{"IPv6", 0x04, netip.MustParseAddr("fd00::2").AsSlice(), 443, "[fd00::2]:443"},
+			{"Domain", 0x03, append([]byte{byte(len("peer1"))}, "peer1"...), 22, "peer1:22"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				conn, reply := connect(t, tt.addrType, tt.addr, tt.port)
+				require.Equal(t, byte(0x00), reply)
+
+				require.Equal(t, tt.expected, wgNet.lastDialed())
+
+				_, err := conn.Write([]byte("hello"))
+				require.NoError(t, err)
+
+				buf := make([]byte, 5)
+				_, err = io.ReadFull(conn, buf)
+				require.NoError(t, err)
+				require.Equal(t, "hello", string(buf))
+			})
+		}
+	})
+
+	t.Run("Unsupported Command", func(t *testing.T) {
+		conn := dial(t)
+
+		_, err := conn.Write([]byte{0x05, 0x01, 0x00})
+		require.NoError(t, err)
+
+		method := make([]byte, 2)
+		_, err = io.ReadFull(conn, method)
+		require.NoError(t, err)
+
+		// BIND.
+		reply := request(t, conn, 0x02, 0x01, netip.MustParseAddr("100.64.0.2").AsSlice(), 80)
+		require.Equal(t, byte(0x07), reply)
+	})
+
+	t.Run("Unsupported Address Type", func(t *testing.T) {
+		conn := dial(t)
+
+		_, err := conn.Write([]byte{0x05, 0x01, 0x00, 0x05, 0x01, 0x00, 0x05})
+		require.NoError(t, err)
+
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x05, 0x00, 0x05, 0x08}, buf)
+	})
+
+	t.Run("Dial Errors", func(t *testing.T) {
+		tests := []struct {
+			host     string
+			expected byte
+		}{
+			{"refused.test", 0x05},
+			{"netstack-refused.test", 0x05},
+			{"unreachable.test", 0x04},
+			{"unknown.test", 0x04},
+			{"network-unreachable.test", 0x03},
+			{"broken.test", 0x01},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.host, func(t *testing.T) {
+				_, reply := connect(t, 0x03, append([]byte{byte(len(tt.host))}, tt.host...), 80)
+				require.Equal(t, tt.expected, reply)
+			})
+		}
+	})
+
+	cancel()
+	require.NoError(t, <-errCh)
+}
+
+// request sends a SOCKS5 request and returns the reply code.
+func request(t *testing.T, conn net.Conn, cmd, addrType byte, addr []byte, port uint16) byte {
+	req := append([]byte{0x05, cmd, 0x00, addrType}, addr...)
+	req = binary.BigEndian.AppendUint16(req, port)
+
+	_, err := conn.Write(req)
+	require.NoError(t, err)
+
+	header := make([]byte, 4)
+	_, err = io.ReadFull(conn, header)
+	require.NoError(t, err)
+	require.Equal(t, byte(0x05), header[0])
+
+	// Skip the bind address.
+	addrLen := 4
+	if header[3] == 0x04 {
+		addrLen = 16
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, addrLen+2))
+	require.NoError(t, err)
+
+	return header[1]
+}
+
+func startEchoServer(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = lis.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return lis.Addr().String()
+}
+
+func freeTCPAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	return addr
+}
+
+// fakeDialNetwork records the addresses dialed, and connects them all to the
+// same target (unless an error is configured for the address).
+type fakeDialNetwork struct {
+	network.Network
+	targetAddr string
+	errors     map[string]error
+
+	mu     sync.Mutex
+	dialed []string
+}
+
+func (n *fakeDialNetwork) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	n.mu.Lock()
+	n.dialed = append(n.dialed, address)
+	n.mu.Unlock()
+
+	if err, ok := n.errors[address]; ok {
+		return nil, err
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, n.targetAddr)
+}
+
+func (n *fakeDialNetwork) lastDialed() string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if len(n.dialed) == 0 {
+		return ""
+	}
+
+	return n.dialed[len(n.dialed)-1]
+}
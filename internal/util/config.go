@@ -10,9 +10,11 @@
 package util
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
 	"os"
 	"path/filepath"
 
@@ -21,8 +23,266 @@ import (
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
 )
 
+// configSource records how a config was stored, so that it can be written
+// back the same way.
+type configSource struct {
+	// passphrase is the passphrase the config was encrypted with (if any).
+	passphrase string
+	// keyringID is the id of the private key in the OS keyring (if any).
+	keyringID string
+	// privateKey is the private key that was loaded from the keyring.
+	privateKey string
+}
+
+// ParseConfig parses config file data, decrypting it, expanding any templating
+// (relative to dir), and loading the private key from the OS keyring if
+// required.
+func ParseConfig(data []byte, dir string) (*latestconfig.Config, error) {
+	data, src, err := decryptConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = ExpandConfig(data, dir)
+	if err != nil {
+		return nil, fmt.Errorf("error expanding config: %w", err)
+	}
+
+	return unmarshalConfig(data, src)
+}
+
+// ParseRemoteConfig parses config file data fetched from a remote source.
+// Remote configs aren't expanded, as environment variable references could be
+// used to leak local values (eg. in the hostname of a peer endpoint).
+func ParseRemoteConfig(data []byte) (*latestconfig.Config, error) {
+	data, src, err := decryptConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if IsTemplated(data) {
+		return nil, errors.New("remote configs can't use environment variables or includes")
+	}
+
+	return unmarshalConfig(data, src)
+}
+
+// parseConfig parses config file data, so that it can be updated and written
+// back the same way it was stored.
+func parseConfig(data []byte) (*latestconfig.Config, *configSource, error) {
+	data, src, err := decryptConfig(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Writing the config back would bake in the expanded values.
+	if IsTemplated(data) {
+		return nil, nil, errors.New("config uses environment variables or includes, edit it by hand instead")
+	}
+
+	conf, err := unmarshalConfig(data, src)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return conf, src, nil
+}
+
+func decryptConfig(data []byte) ([]byte, *configSource, error) {
+	var src configSource
+	if IsEncrypted(data) {
+		var err error
+		src.passphrase, err = ReadPassphrase(false)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err = Decrypt(data, src.passphrase)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error decrypting config: %w", err)
+		}
+	}
+
+	return data, &src, nil
+}
+
+func unmarshalConfig(data []byte, src *configSource) (*latestconfig.Config, error) {
+	conf, err := config.FromYAML(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if id, ok := KeyringID(conf.PrivateKey); ok {
+		conf.PrivateKey, err = LoadPrivateKey(id)
+		if err != nil {
+			return nil, err
+		}
+
+		src.keyringID = id
+		src.privateKey = conf.PrivateKey
+	}
+
+	return conf, nil
+}
+
 // UpdateConfig performs an atomic update on the given config file.
 func UpdateConfig(logger *slog.Logger, configPath string, update func(*latestconfig.Config) (*latestconfig.Config, error)) error {
+	return updateConfigFile(logger, configPath, func(data []byte) ([]byte, error) {
+		var conf *latestconfig.Config
+		src := &configSource{}
+		if data != nil {
+			var err error
+			conf, src, err = parseConfig(data)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing config: %w", err)
+			}
+		}
+
+		updatedConf, err := update(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		// Keep the private key in the keyring if it was before.
+		if src.keyringID != "" {
+			if updatedConf.PrivateKey != src.privateKey {
+				if err := StorePrivateKey(src.keyringID, updatedConf.PrivateKey); err != nil {
+					return nil, err
+				}
+			}
+
+			confWithRef := *updatedConf
+			confWithRef.PrivateKey = KeyringReference(src.keyringID)
+			updatedConf = &confWithRef
+		}
+
+		var buf bytes.Buffer
+		if err := config.ToYAML(&buf, updatedConf); err != nil {
+			return nil, fmt.Errorf("error writing config: %w", err)
+		}
+
+		// Keep the config encrypted if it was before.
+		if src.passphrase != "" {
+			return Encrypt(buf.Bytes(), src.passphrase)
+		}
+
+		return buf.Bytes(), nil
+	})
+}
+
+// MoveKeyToKeyring moves the private key from the given config file into the
+// OS keyring, replacing it with a reference to the keyring entry.
+func MoveKeyToKeyring(logger *slog.Logger, configPath, id string) error {
+	return UpdateConfig(logger, configPath, func(conf *latestconfig.Config) (*latestconfig.Config, error) {
+		if conf == nil {
+			return nil, fmt.Errorf("config file %q does not exist", configPath)
+		}
+
+		if _, ok := KeyringID(conf.PrivateKey); ok {
+			return nil, errors.New("private key is already stored in the keyring")
+		}
+
+		if err := StorePrivateKey(id, conf.PrivateKey); err != nil {
+			return nil, err
+		}
+
+		conf.PrivateKey = KeyringReference(id)
+
+		return conf, nil
+	})
+}
+
+// MoveKeyFromKeyring moves the private key referenced by the given config file
+// out of the OS keyring, and back into the config file.
+func MoveKeyFromKeyring(logger *slog.Logger, configPath string) error {
+	return updateConfigFile(logger, configPath, func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, fmt.Errorf("config file %q does not exist", configPath)
+		}
+
+		conf, src, err := parseConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing config: %w", err)
+		}
+
+		if src.keyringID == "" {
+			return nil, errors.New("private key is not stored in the keyring")
+		}
+
+		var buf bytes.Buffer
+		if err := config.ToYAML(&buf, conf); err != nil {
+			return nil, fmt.Errorf("error writing config: %w", err)
+		}
+
+		updatedData := buf.Bytes()
+		if src.passphrase != "" {
+			updatedData, err = Encrypt(updatedData, src.passphrase)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Only remove the key once we know the config can be written.
+		if err := DeletePrivateKey(src.keyringID); err != nil {
+			return nil, err
+		}
+
+		return updatedData, nil
+	})
+}
+
+// EncryptConfig encrypts the given config file at rest with a passphrase.
+func EncryptConfig(logger *slog.Logger, configPath string) error {
+	return updateConfigFile(logger, configPath, func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, fmt.Errorf("config file %q does not exist", configPath)
+		}
+
+		if IsEncrypted(data) {
+			return nil, errors.New("config is already encrypted")
+		}
+
+		passphrase, err := ReadPassphrase(true)
+		if err != nil {
+			return nil, err
+		}
+
+		return Encrypt(data, passphrase)
+	})
+}
+
+// DecryptConfig decrypts the given (encrypted) config file.
+func DecryptConfig(logger *slog.Logger, configPath string) error {
+	return updateConfigFile(logger, configPath, func(data []byte) ([]byte, error) {
+		if data == nil {
+			return nil, fmt.Errorf("config file %q does not exist", configPath)
+		}
+
+		if !IsEncrypted(data) {
+			return nil, errors.New("config is not encrypted")
+		}
+
+		passphrase, err := ReadPassphrase(false)
+		if err != nil {
+			return nil, err
+		}
+
+		decrypted, err := Decrypt(data, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error decrypting config: %w", err)
+		}
+
+		return decrypted, nil
+	})
+}
+
+// updateConfigFile performs an atomic update on the raw contents of the given
+// config file. If the file does not exist, update is called with nil data.
+func updateConfigFile(logger *slog.Logger, configPath string, update func([]byte) ([]byte, error)) error {
+	if IsRemoteConfig(configPath) {
+		return errors.New("remote config files can't be updated, edit them at the source instead")
+	}
+
 	lockPath := configPath + ".lock"
 	lock := flock.New(lockPath)
 	locked, err := lock.TryLock()
@@ -42,23 +302,14 @@ func UpdateConfig(logger *slog.Logger, configPath string, update func(*latestcon
 		}
 	}()
 
-	configFile, err := os.Open(configPath)
+	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return fmt.Errorf("error opening config file: %w", err)
 		}
 	}
 
-	var conf *latestconfig.Config
-	if configFile != nil {
-		conf, err = config.FromYAML(configFile)
-		_ = configFile.Close()
-		if err != nil {
-			return fmt.Errorf("error parsing config: %w", err)
-		}
-	}
-
-	updatedConf, err := update(conf)
+	updatedData, err := update(data)
 	if err != nil {
 		return err
 	}
@@ -71,15 +322,38 @@ func UpdateConfig(logger *slog.Logger, configPath string, update func(*latestcon
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	configFile, err = os.OpenFile(configPath, os.O_CREATE|os.O_WRONLY, 0o400)
-	if err != nil {
-		return fmt.Errorf("error opening config file: %w", err)
-	}
-	defer configFile.Close()
-
-	if err := config.ToYAML(configFile, updatedConf); err != nil {
+	if err := os.WriteFile(configPath, updatedData, 0o400); err != nil {
 		return fmt.Errorf("error writing config: %w", err)
 	}
 
 	return nil
 }
+
+// Hosts returns a map of the addresses on the WireGuard network to the names
+// of the peers (including this one) they are assigned to.
+func Hosts(conf *latestconfig.Config) map[netip.Addr]string {
+	hosts := make(map[netip.Addr]string)
+
+	addHost := func(name string, ips []string) {
+		if name == "" {
+			return
+		}
+
+		for _, ip := range ips {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil {
+				continue
+			}
+
+			hosts[addr.Unmap()] = name
+		}
+	}
+
+	addHost(conf.Name, conf.IPs)
+
+	for _, peerConf := range conf.Peers {
+		addHost(peerConf.Name, peerConf.IPs)
+	}
+
+	return hosts
+}
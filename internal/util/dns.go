@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"context"
+	"fmt"
+	stdnet "net"
+	"net/netip"
+)
+
+// ResolveDNSServers converts a list of DNS server addresses, in either host or
+// host:port form, into the IP literal form expected by the config. Hostnames
+// are resolved using the host resolver.
+func ResolveDNSServers(ctx context.Context, servers []string) ([]string, error) {
+	var resolved []string
+	for _, server := range servers {
+		host, port, err := stdnet.SplitHostPort(server)
+		if err != nil {
+			// No port specified.
+			host, port = server, ""
+		}
+
+		addr, err := netip.ParseAddr(host)
+		if err != nil {
+			addrs, err := stdnet.DefaultResolver.LookupNetIP(ctx, "ip", host)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve DNS server %q: %w", server, err)
+			}
+
+			if len(addrs) == 0 {
+				return nil, fmt.Errorf("failed to resolve DNS server %q: no addresses found", server)
+			}
+
+			addr = addrs[0].Unmap()
+		}
+
+		if port != "" {
+			resolved = append(resolved, stdnet.JoinHostPort(addr.String(), port))
+		} else {
+			resolved = append(resolved, addr.String())
+		}
+	}
+
+	return resolved, nil
+}
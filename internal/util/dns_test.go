@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveDNSServers(t *testing.T) {
+	servers, err := util.ResolveDNSServers(context.Background(), []string{
+		"10.0.0.1",
+		"10.0.0.2:5353",
+		"fd00::1",
+		"[fd00::2]:5353",
+		"localhost:53",
+	})
+	require.NoError(t, err)
+
+	require.Len(t, servers, 5)
+	require.Equal(t, "10.0.0.1", servers[0])
+	require.Equal(t, "10.0.0.2:5353", servers[1])
+	require.Equal(t, "fd00::1", servers[2])
+	require.Equal(t, "[fd00::2]:5353", servers[3])
+	require.Contains(t, []string{"127.0.0.1:53", "[::1]:53"}, servers[4])
+
+	_, err = util.ResolveDNSServers(context.Background(), []string{"nonexistent.invalid"})
+	require.Error(t, err)
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"golang.org/x/term"
+)
+
+// ConfigPassphraseEnv is the environment variable used to provide the
+// passphrase for encrypted config files (instead of prompting for it).
+const ConfigPassphraseEnv = "NSH_CONFIG_PASSPHRASE"
+
+// The passphrase is remembered once entered, so commands that read the config
+// more than once only prompt for it once.
+var cachedPassphrase string
+
+// IsEncrypted returns true if the config file data is age encrypted.
+func IsEncrypted(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return bytes.HasPrefix(data, []byte(armor.Header)) || bytes.HasPrefix(data, []byte("age-encryption.org/"))
+}
+
+// Encrypt encrypts the config file data with the given passphrase, the
+// result is ASCII armored.
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recipient: %w", err)
+	}
+
+	var buf bytes.Buffer
+	armorWriter := armor.NewWriter(&buf)
+
+	w, err := age.Encrypt(armorWriter, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	if err := armorWriter.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts age encrypted config file data with the given passphrase.
+func Decrypt(data []byte, passphrase string) ([]byte, error) {
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armor.Header)) {
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+
+	decrypted, err := age.Decrypt(r, identity)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, errors.New("incorrect passphrase")
+		}
+
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return io.ReadAll(decrypted)
+}
+
+// ReadPassphrase returns the config passphrase from the environment, or
+// prompts the user for it if stdin is a terminal. If confirm is true, the
+// user will be asked to enter the passphrase twice.
+func ReadPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv(ConfigPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	if !confirm && cachedPassphrase != "" {
+		return cachedPassphrase, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("config passphrase required, set %s", ConfigPassphraseEnv)
+	}
+
+	readPassphrase := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		passphrase, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+
+		return string(passphrase), nil
+	}
+
+	passphrase, err := readPassphrase("Config passphrase: ")
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" {
+		return "", errors.New("passphrase must not be empty")
+	}
+
+	if confirm {
+		confirmation, err := readPassphrase("Confirm passphrase: ")
+		if err != nil {
+			return "", err
+		}
+
+		if confirmation != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+
+	cachedPassphrase = passphrase
+
+	return passphrase, nil
+}
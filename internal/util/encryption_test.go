@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	data := []byte("apiVersion: noisysockets.github.com/v1alpha2\nkind: Config\n")
+
+	require.False(t, util.IsEncrypted(data))
+
+	encrypted, err := util.Encrypt(data, "hunter2")
+	require.NoError(t, err)
+
+	require.True(t, util.IsEncrypted(encrypted))
+	require.NotContains(t, string(encrypted), "kind: Config")
+
+	decrypted, err := util.Decrypt(encrypted, "hunter2")
+	require.NoError(t, err)
+	require.Equal(t, data, decrypted)
+
+	_, err = util.Decrypt(encrypted, "wrong")
+	require.EqualError(t, err, "incorrect passphrase")
+}
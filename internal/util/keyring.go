@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringReferencePrefix marks a private key that is stored in the OS keyring,
+// eg. "keyring:work".
+const keyringReferencePrefix = "keyring:"
+
+// The service name that private keys are stored under in the OS keyring.
+const keyringService = "nsh"
+
+// KeyringReference returns the config private key value that refers to the
+// keyring entry with the given id.
+func KeyringReference(id string) string {
+	return keyringReferencePrefix + id
+}
+
+// KeyringID returns the id of the keyring entry referred to by the given
+// config private key value, if it is a keyring reference.
+func KeyringID(privateKey string) (string, bool) {
+	id, ok := strings.CutPrefix(privateKey, keyringReferencePrefix)
+	return id, ok && id != ""
+}
+
+// StorePrivateKey stores a private key in the OS keyring.
+func StorePrivateKey(id, privateKey string) error {
+	if err := keyring.Set(keyringService, id, privateKey); err != nil {
+		return fmt.Errorf("failed to store private key in keyring: %w", err)
+	}
+
+	return nil
+}
+
+// LoadPrivateKey loads a private key from the OS keyring.
+func LoadPrivateKey(id string) (string, error) {
+	privateKey, err := keyring.Get(keyringService, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to load private key %q from keyring: %w", id, err)
+	}
+
+	return privateKey, nil
+}
+
+// DeletePrivateKey removes a private key from the OS keyring.
+func DeletePrivateKey(id string) error {
+	if err := keyring.Delete(keyringService, id); err != nil {
+		return fmt.Errorf("failed to delete private key %q from keyring: %w", id, err)
+	}
+
+	return nil
+}
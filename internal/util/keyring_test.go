@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+func TestKeyring(t *testing.T) {
+	keyring.MockInit()
+
+	logger := slog.Default()
+	configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+
+	err := util.UpdateConfig(logger, configPath, func(_ *latestconfig.Config) (*latestconfig.Config, error) {
+		return &latestconfig.Config{
+			Name:       "test",
+			PrivateKey: "private-key",
+		}, nil
+	})
+	require.NoError(t, err)
+
+	parseConfig := func() *latestconfig.Config {
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+
+		conf, err := util.ParseConfig(data, filepath.Dir(configPath))
+		require.NoError(t, err)
+
+		return conf
+	}
+
+	t.Run("Store", func(t *testing.T) {
+		require.NoError(t, util.MoveKeyToKeyring(logger, configPath, "test"))
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Contains(t, string(data), "privateKey: keyring:test")
+
+		require.Equal(t, "private-key", parseConfig().PrivateKey)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		err := util.UpdateConfig(logger, configPath, func(conf *latestconfig.Config) (*latestconfig.Config, error) {
+			require.Equal(t, "private-key", conf.PrivateKey)
+
+			conf.PrivateKey = "new-private-key"
+			return conf, nil
+		})
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Contains(t, string(data), "privateKey: keyring:test")
+
+		require.Equal(t, "new-private-key", parseConfig().PrivateKey)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		require.NoError(t, util.MoveKeyFromKeyring(logger, configPath))
+
+		data, err := os.ReadFile(configPath)
+		require.NoError(t, err)
+		require.Contains(t, string(data), "privateKey: new-private-key")
+
+		_, err = util.LoadPrivateKey("test")
+		require.Error(t, err)
+	})
+}
@@ -10,6 +10,8 @@
 package util
 
 import (
+	"fmt"
+	"io"
 	"log/slog"
 	"strings"
 )
@@ -29,3 +31,23 @@ func (f *LevelFlag) Set(value string) error {
 func (f *LevelFlag) String() string {
 	return (*slog.Level)(f).String()
 }
+
+const (
+	// LogFormatText is the human readable logfmt style log format.
+	LogFormatText = "text"
+	// LogFormatJSON is the structured JSON log format.
+	LogFormatJSON = "json"
+)
+
+// NewLogHandler returns a slog handler that writes records to w in the
+// given format.
+func NewLogHandler(w io.Writer, format string, opts *slog.HandlerOptions) (slog.Handler, error) {
+	switch format {
+	case LogFormatText:
+		return slog.NewTextHandler(w, opts), nil
+	case LogFormatJSON:
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unsupported log format %q", format)
+	}
+}
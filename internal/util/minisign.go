@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Minisign signature algorithms, legacy signatures are over the data itself,
+// while prehashed signatures are over its BLAKE2b-512 hash.
+const (
+	minisignAlgLegacy    = "Ed"
+	minisignAlgPrehashed = "ED"
+)
+
+// VerifyMinisign verifies a minisign (https://jedisct1.github.io/minisign/)
+// signature of data. The public key is either the base64 encoded key, or the
+// contents of a minisign public key file.
+func VerifyMinisign(publicKey string, data, signature []byte) error {
+	keyID, key, err := parseMinisignPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid signature file")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid signature")
+	}
+
+	alg, sigKeyID, sig := string(sig[:2]), sig[2:10], sig[10:]
+	if !bytes.Equal(sigKeyID, keyID) {
+		return errors.New("signature was made with a different key")
+	}
+
+	message := data
+	switch alg {
+	case minisignAlgLegacy:
+	case minisignAlgPrehashed:
+		sum := blake2b.Sum512(data)
+		message = sum[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+
+	if !ed25519.Verify(key, message, sig) {
+		return errors.New("signature verification failed")
+	}
+
+	// The trusted comment is signed along with the signature.
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid trusted comment signature")
+	}
+
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(key, append(sig, trustedComment...), globalSig) {
+		return errors.New("trusted comment verification failed")
+	}
+
+	return nil
+}
+
+func parseMinisignPublicKey(publicKey string) ([]byte, ed25519.PublicKey, error) {
+	// Skip the untrusted comment of a public key file.
+	lines := strings.Split(strings.TrimSpace(publicKey), "\n")
+	encoded := strings.TrimSpace(lines[len(lines)-1])
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 2+8+ed25519.PublicKeySize {
+		return nil, nil, errors.New("invalid minisign public key")
+	}
+
+	if string(key[:2]) != minisignAlgLegacy {
+		return nil, nil, fmt.Errorf("unsupported public key algorithm %q", key[:2])
+	}
+
+	return key[2:10], ed25519.PublicKey(key[10:]), nil
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// How long to wait when fetching a remote config.
+const fetchTimeout = 30 * time.Second
+
+// The largest remote config we're willing to download.
+const maxRemoteConfigSize = 10 * 1024 * 1024
+
+// IsRemoteConfig returns whether the config path is a URL to fetch the config
+// from, rather than a local file.
+func IsRemoteConfig(configPath string) bool {
+	for _, scheme := range []string{"http://", "https://", "s3://"} {
+		if strings.HasPrefix(configPath, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FetchConfig downloads the config file from the given URL. If a minisign
+// public key is provided, the detached signature (at the same URL with a
+// ".minisig" suffix) is verified. Verified configs are cached, so that the
+// last known good config can be used if the source is unreachable.
+func FetchConfig(ctx context.Context, logger *slog.Logger, configURL, publicKey string) ([]byte, error) {
+	cachePath, err := xdg.CacheFile(filepath.Join("nsh", "remote", cacheKey(configURL)+".yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config cache path: %w", err)
+	}
+
+	if publicKey == "" && strings.HasPrefix(configURL, "http://") {
+		return nil, errors.New("refusing to fetch config over plain HTTP without signature verification, use https:// or provide a public key")
+	}
+
+	data, sig, err := fetchConfig(ctx, configURL, publicKey != "")
+	if err == nil {
+		if publicKey != "" {
+			if err := VerifyMinisign(publicKey, data, sig); err != nil {
+				// Don't fall back to the cache, something is wrong with the source.
+				return nil, fmt.Errorf("invalid config signature: %w", err)
+			}
+		}
+
+		if err := writeCache(cachePath, data, sig); err != nil {
+			logger.Warn("Failed to cache config", slog.Any("error", err))
+		}
+
+		return data, nil
+	}
+
+	logger.Warn("Failed to fetch config, using cached copy",
+		slog.String("url", configURL), slog.Any("error", err))
+
+	data, cacheErr := os.ReadFile(cachePath)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed to fetch config: %w", err)
+	}
+
+	// The public key may have changed since the config was cached.
+	if publicKey != "" {
+		sig, err := os.ReadFile(cachePath + ".minisig")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached config signature: %w", err)
+		}
+
+		if err := VerifyMinisign(publicKey, data, sig); err != nil {
+			return nil, fmt.Errorf("invalid cached config signature: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+func fetchConfig(ctx context.Context, configURL string, signed bool) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	configURL = httpURL(configURL)
+
+	data, err := fetch(ctx, configURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !signed {
+		return data, nil, nil
+	}
+
+	sig, err := fetch(ctx, configURL+".minisig")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch signature: %w", err)
+	}
+
+	return data, sig, nil
+}
+
+func fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxRemoteConfigSize {
+		return nil, fmt.Errorf("%s is too large", url)
+	}
+
+	return data, nil
+}
+
+// httpURL converts s3://bucket/key URLs into their (virtual hosted) HTTPS
+// equivalent.
+func httpURL(configURL string) string {
+	bucketAndKey, ok := strings.CutPrefix(configURL, "s3://")
+	if !ok {
+		return configURL
+	}
+
+	bucket, key, _ := strings.Cut(bucketAndKey, "/")
+	return "https://" + bucket + ".s3.amazonaws.com/" + key
+}
+
+func writeCache(cachePath string, data, sig []byte) error {
+	// The config probably contains a private key.
+	if err := os.WriteFile(cachePath, data, 0o600); err != nil {
+		return err
+	}
+
+	if sig != nil {
+		return os.WriteFile(cachePath+".minisig", sig, 0o600)
+	}
+
+	return nil
+}
+
+func cacheKey(configURL string) string {
+	sum := sha256.Sum256([]byte(configURL))
+	return hex.EncodeToString(sum[:8])
+}
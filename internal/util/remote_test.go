@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestFetchConfig(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	xdg.Reload()
+	t.Cleanup(xdg.Reload)
+
+	publicKey, privateKey, keyID := generateMinisignKey(t)
+
+	config := []byte("name: server\n")
+	signature := minisign(privateKey, keyID, config, true)
+
+	var down bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/noisysockets.yaml":
+			_, _ = w.Write(config)
+		case "/noisysockets.yaml.minisig":
+			_, _ = w.Write(signature)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	logger := slog.Default()
+	configURL := srv.URL + "/noisysockets.yaml"
+
+	require.True(t, util.IsRemoteConfig(configURL))
+
+	t.Run("Signed", func(t *testing.T) {
+		data, err := util.FetchConfig(ctx, logger, configURL, publicKey)
+		require.NoError(t, err)
+		require.Equal(t, config, data)
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		down = true
+		t.Cleanup(func() { down = false })
+
+		data, err := util.FetchConfig(ctx, logger, configURL, publicKey)
+		require.NoError(t, err)
+		require.Equal(t, config, data)
+	})
+
+	t.Run("Wrong Key", func(t *testing.T) {
+		otherPublicKey, _, _ := generateMinisignKey(t)
+
+		_, err := util.FetchConfig(ctx, logger, configURL, otherPublicKey)
+		require.ErrorContains(t, err, "invalid config signature")
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		original := config
+		config = []byte("name: attacker\n")
+		t.Cleanup(func() { config = original })
+
+		_, err := util.FetchConfig(ctx, logger, configURL, publicKey)
+		require.ErrorContains(t, err, "signature verification failed")
+	})
+
+	t.Run("Unsigned Plain HTTP", func(t *testing.T) {
+		_, err := util.FetchConfig(ctx, logger, configURL, "")
+		require.ErrorContains(t, err, "refusing to fetch config over plain HTTP")
+	})
+}
+
+func TestParseRemoteConfig(t *testing.T) {
+	t.Setenv("NSH_TEST_NAME", "server")
+
+	_, err := util.ParseRemoteConfig([]byte("name: ${NSH_TEST_NAME}\n"))
+	require.ErrorContains(t, err, "can't use environment variables")
+
+	conf, err := util.ParseRemoteConfig([]byte(`kind: Config
+apiVersion: noisysockets.github.com/v1alpha2
+name: server # ${NSH_TEST_NAME}
+privateKey: cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU=
+`))
+	require.NoError(t, err)
+	require.Equal(t, "server", conf.Name)
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	publicKey, privateKey, keyID := generateMinisignKey(t)
+	data := []byte("hello world")
+
+	for _, prehashed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("Prehashed %v", prehashed), func(t *testing.T) {
+			signature := minisign(privateKey, keyID, data, prehashed)
+
+			require.NoError(t, util.VerifyMinisign(publicKey, data, signature))
+			require.NoError(t, util.VerifyMinisign("untrusted comment: minisign public key\n"+publicKey+"\n", data, signature))
+			require.Error(t, util.VerifyMinisign(publicKey, []byte("goodbye world"), signature))
+		})
+	}
+}
+
+func generateMinisignKey(t *testing.T) (string, ed25519.PrivateKey, []byte) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyID := make([]byte, 8)
+	_, err = rand.Read(keyID)
+	require.NoError(t, err)
+
+	encoded := append([]byte("Ed"), keyID...)
+	encoded = append(encoded, publicKey...)
+
+	return base64.StdEncoding.EncodeToString(encoded), privateKey, keyID
+}
+
+func minisign(privateKey ed25519.PrivateKey, keyID, data []byte, prehashed bool) []byte {
+	alg := "Ed"
+	if prehashed {
+		alg = "ED"
+		sum := blake2b.Sum512(data)
+		data = sum[:]
+	}
+
+	sig := ed25519.Sign(privateKey, data)
+	trustedComment := "timestamp:1718000000"
+	globalSig := ed25519.Sign(privateKey, append(append([]byte{}, sig...), trustedComment...))
+
+	encodedSig := append([]byte(alg), keyID...)
+	encodedSig = append(encodedSig, sig...)
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(encodedSig), trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig)))
+}
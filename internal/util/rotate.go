@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const rotatedTimeFormat = "20060102T150405.000"
+
+// RotatingFileOptions controls when a RotatingFile is rotated.
+type RotatingFileOptions struct {
+	// MaxSize is the size in bytes after which the file is rotated. Zero
+	// disables size based rotation.
+	MaxSize int64
+	// MaxAge is the duration after which the file is rotated. Zero disables
+	// time based rotation.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to retain. Zero retains all
+	// rotated files.
+	MaxBackups int
+}
+
+// RotatingFile is an append only file that is renamed aside (with a
+// timestamp suffix), and replaced with a new file, once it grows too large
+// or old.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	opts     RotatingFileOptions
+	f        *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// OpenRotatingFile opens (or creates) the file at the given path for
+// appending.
+func OpenRotatingFile(path string, opts RotatingFileOptions) (*RotatingFile, error) {
+	rf := &RotatingFile{
+		path: path,
+		opts: opts,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooLarge := rf.opts.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.opts.MaxSize
+	tooOld := rf.opts.MaxAge > 0 && time.Since(rf.openedAt) >= rf.opts.MaxAge
+	if tooLarge || tooOld {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.f.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.f == nil {
+		return nil
+	}
+
+	err := rf.f.Close()
+	rf.f = nil
+	return err
+}
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	rf.f = f
+	rf.size = fi.Size()
+	rf.openedAt = time.Now()
+
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.f.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	rf.f = nil
+
+	rotatedPath := rf.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	if err := os.Rename(rf.path, rotatedPath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	return rf.removeOldBackups()
+}
+
+func (rf *RotatingFile) removeOldBackups() error {
+	if rf.opts.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(rf.path + ".*")
+	if err != nil {
+		return fmt.Errorf("failed to list rotated files: %w", err)
+	}
+
+	var rotated []string
+	for _, backup := range backups {
+		suffix := backup[len(rf.path)+1:]
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			rotated = append(rotated, backup)
+		}
+	}
+
+	if len(rotated) <= rf.opts.MaxBackups {
+		return nil
+	}
+
+	// The timestamp suffix sorts chronologically.
+	sort.Strings(rotated)
+
+	for _, backup := range rotated[:len(rotated)-rf.opts.MaxBackups] {
+		if err := os.Remove(backup); err != nil {
+			return fmt.Errorf("failed to remove rotated file: %w", err)
+		}
+	}
+
+	return nil
+}
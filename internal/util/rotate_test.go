@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	t.Run("Size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nsh.log")
+
+		rf, err := util.OpenRotatingFile(path, util.RotatingFileOptions{
+			MaxSize:    10,
+			MaxBackups: 1,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, rf.Close())
+		})
+
+		for _, line := range []string{"first\n", "second\n", "third\n"} {
+			_, err := rf.Write([]byte(line))
+			require.NoError(t, err)
+
+			// Rotated files are named with millisecond resolution.
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "third\n", string(data))
+
+		backups, err := filepath.Glob(path + ".*")
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+
+		data, err = os.ReadFile(backups[0])
+		require.NoError(t, err)
+		require.Equal(t, "second\n", string(data))
+	})
+
+	t.Run("Age", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "nsh.log")
+
+		rf, err := util.OpenRotatingFile(path, util.RotatingFileOptions{
+			MaxAge: 10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			require.NoError(t, rf.Close())
+		})
+
+		_, err = rf.Write([]byte("first\n"))
+		require.NoError(t, err)
+
+		time.Sleep(20 * time.Millisecond)
+
+		_, err = rf.Write([]byte("second\n"))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "second\n", string(data))
+
+		backups, err := filepath.Glob(path + ".*")
+		require.NoError(t, err)
+		require.Len(t, backups, 1)
+	})
+}
@@ -0,0 +1,288 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Matches ${NAME}, ${NAME:-default}, and the escaped form $${...}.
+var envVarPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// ExpandConfig expands any environment variable references (${NAME}, or
+// ${NAME:-default}) in config file values, and replaces any `include` entries
+// in the list of peers with the peers listed in the referenced files. Include
+// paths may be glob patterns, and are relative to dir (if not empty). A literal
+// "${" can be written as "$${".
+func ExpandConfig(data []byte, dir string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		// Leave it to the config parser to report.
+		return data, nil
+	}
+
+	expanded, err := expandEnv(&root)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := peersNode(&root)
+	if peers != nil && hasIncludes(peers) {
+		var items []*yaml.Node
+		for _, item := range peers.Content {
+			pattern, ok := includePath(item)
+			if !ok {
+				items = append(items, item)
+				continue
+			}
+
+			included, err := includePeers(pattern, dir)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, included...)
+		}
+		peers.Content = items
+	} else if !expanded {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, fmt.Errorf("failed to encode expanded config: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// IsTemplated returns whether the config file data uses environment variables
+// or includes, and so can't be safely rewritten.
+func IsTemplated(data []byte) bool {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return false
+	}
+
+	if hasEnvVars(&root) {
+		return true
+	}
+
+	peers := peersNode(&root)
+	return peers != nil && hasIncludes(peers)
+}
+
+// expandEnv expands environment variable references in the scalar values of
+// the document, and returns whether any were found. Only values are expanded
+// (never keys or comments), and an expanded value is always a single scalar,
+// so the environment can't change the structure of the document.
+func expandEnv(node *yaml.Node) (bool, error) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		var expanded bool
+		var errs []error
+		for _, child := range node.Content {
+			ok, err := expandEnv(child)
+			expanded = expanded || ok
+			errs = append(errs, err)
+		}
+		return expanded, errors.Join(errs...)
+	case yaml.MappingNode:
+		var expanded bool
+		var errs []error
+		for i := 1; i < len(node.Content); i += 2 {
+			ok, err := expandEnv(node.Content[i])
+			expanded = expanded || ok
+			errs = append(errs, err)
+		}
+		return expanded, errors.Join(errs...)
+	case yaml.ScalarNode:
+		if !envVarPattern.MatchString(node.Value) {
+			return false, nil
+		}
+
+		value, err := expandEnvValue(node.Value)
+		if err != nil {
+			return true, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+
+		// Let unquoted values resolve to the type of the expanded value (eg.
+		// ports), quoted values are always strings.
+		if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+func expandEnvValue(value string) (string, error) {
+	var errs []error
+	expanded := envVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		m := envVarPattern.FindStringSubmatch(match)
+		name := m[1]
+		// Like the shell, ":-" also substitutes the default for empty values.
+		if value, ok := os.LookupEnv(name); ok && (value != "" || m[2] == "") {
+			return value
+		}
+
+		if m[2] != "" {
+			return m[3]
+		}
+
+		errs = append(errs, fmt.Errorf("environment variable %q is not set", name))
+		return match
+	})
+
+	return expanded, errors.Join(errs...)
+}
+
+// hasEnvVars returns whether any of the values in the document reference
+// environment variables.
+func hasEnvVars(node *yaml.Node) bool {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		return slices.ContainsFunc(node.Content, hasEnvVars)
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if hasEnvVars(node.Content[i]) {
+				return true
+			}
+		}
+		return false
+	case yaml.ScalarNode:
+		return envVarPattern.MatchString(node.Value)
+	default:
+		return false
+	}
+}
+
+// peersNode returns the sequence node of peers in the config document.
+func peersNode(root *yaml.Node) *yaml.Node {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return nil
+	}
+
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "peers" && doc.Content[i+1].Kind == yaml.SequenceNode {
+			return doc.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+func hasIncludes(peers *yaml.Node) bool {
+	for _, item := range peers.Content {
+		if _, ok := includePath(item); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// includePath returns the path of an `include: path` peer entry.
+func includePath(item *yaml.Node) (string, bool) {
+	if item.Kind != yaml.MappingNode || len(item.Content) != 2 {
+		return "", false
+	}
+
+	key, value := item.Content[0], item.Content[1]
+	if key.Value != "include" || value.Kind != yaml.ScalarNode {
+		return "", false
+	}
+
+	return value.Value, true
+}
+
+// includePeers reads the peer lists from the files matching the pattern.
+func includePeers(pattern, dir string) ([]*yaml.Node, error) {
+	if !filepath.IsAbs(pattern) {
+		// Eg. remote configs.
+		if dir == "" {
+			return nil, fmt.Errorf("relative include %q is only supported in local config files", pattern)
+		}
+
+		pattern = filepath.Join(dir, pattern)
+	}
+
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+	}
+
+	// A pattern may legitimately match nothing (eg. an empty directory of
+	// peers), but a missing file is probably a mistake.
+	if len(paths) == 0 && !hasMeta(pattern) {
+		return nil, fmt.Errorf("included file %q does not exist", pattern)
+	}
+
+	var peers []*yaml.Node
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read included file: %w", err)
+		}
+
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("failed to parse included file %q: %w", path, err)
+		}
+
+		if _, err := expandEnv(&root); err != nil {
+			return nil, fmt.Errorf("failed to expand included file %q: %w", path, err)
+		}
+
+		if len(root.Content) == 0 {
+			continue
+		}
+
+		list := root.Content[0]
+		if list.Kind != yaml.SequenceNode {
+			// Also accept a config file, with a top level list of peers.
+			list = peersNode(&root)
+			if list == nil {
+				return nil, fmt.Errorf("included file %q is not a list of peers", path)
+			}
+		}
+
+		peers = append(peers, list.Content...)
+	}
+
+	return peers, nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[`)
+}
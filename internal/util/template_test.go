@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/noisysockets/nsh/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+const templatedConfig = `kind: Config
+apiVersion: noisysockets.github.com/v1alpha2
+name: ${NSH_TEST_NAME}
+listenPort: ${NSH_TEST_PORT:-51820}
+privateKey: ${NSH_TEST_PRIVATE_KEY}
+ips:
+  - 100.64.0.1
+peers:
+  - name: gateway
+    publicKey: zzZQPVEk52JZhnxNP/iGQnImksI/XfSzdv901MPfPUY=
+    ips:
+      - 100.64.0.2
+  - include: peers/*.yaml
+`
+
+func TestExpandConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "peers"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "peers", "laptop.yaml"), []byte(`- name: laptop
+  publicKey: +gfcmfN5MCS5KH8KLLNCME3BSdKp00KTEcawVcrt2ls=
+  ips:
+    - 100.64.0.3
+`), 0o600))
+
+	t.Setenv("NSH_TEST_NAME", "server")
+	t.Setenv("NSH_TEST_PRIVATE_KEY", "cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU=")
+
+	require.True(t, util.IsTemplated([]byte(templatedConfig)))
+
+	conf, err := util.ParseConfig([]byte(templatedConfig), dir)
+	require.NoError(t, err)
+
+	require.Equal(t, "server", conf.Name)
+	require.Equal(t, uint16(51820), conf.ListenPort)
+	require.Equal(t, "cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU=", conf.PrivateKey)
+
+	require.Len(t, conf.Peers, 2)
+	require.Equal(t, "gateway", conf.Peers[0].Name)
+	require.Equal(t, "laptop", conf.Peers[1].Name)
+	require.Equal(t, []string{"100.64.0.3"}, conf.Peers[1].IPs)
+}
+
+func TestExpandConfigValues(t *testing.T) {
+	const config = `kind: Config
+apiVersion: noisysockets.github.com/v1alpha2
+# The private key can be set with ${NSH_TEST_UNSET}.
+name: ${NSH_TEST_NAME} # ${NSH_TEST_UNSET}
+listenPort: ${NSH_TEST_PORT:-51820}
+privateKey: cK4z2Mc9oRNM3t6oZT5zJw8GJ4lNsaJlNqrXiUBp0HU=
+`
+
+	t.Run("Comments", func(t *testing.T) {
+		require.False(t, util.IsTemplated([]byte("name: server # ${NSH_TEST_UNSET}\n")))
+
+		t.Setenv("NSH_TEST_NAME", "server")
+
+		conf, err := util.ParseConfig([]byte(config), "")
+		require.NoError(t, err)
+		require.Equal(t, "server", conf.Name)
+	})
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"Comment Character", "foo #bar"},
+		{"Newline", "x\nlistenPort: 1234"},
+		{"Colon", "foo: bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NSH_TEST_NAME", tt.value)
+
+			conf, err := util.ParseConfig([]byte(config), "")
+			require.NoError(t, err)
+
+			require.Equal(t, tt.value, conf.Name)
+			require.Equal(t, uint16(51820), conf.ListenPort)
+		})
+	}
+}
+
+func TestExpandConfigErrors(t *testing.T) {
+	t.Run("Unset Variable", func(t *testing.T) {
+		_, err := util.ExpandConfig([]byte("name: ${NSH_TEST_UNSET}\n"), t.TempDir())
+		require.ErrorContains(t, err, `"NSH_TEST_UNSET" is not set`)
+	})
+
+	t.Run("Missing Include", func(t *testing.T) {
+		_, err := util.ExpandConfig([]byte("peers:\n  - include: missing.yaml\n"), t.TempDir())
+		require.ErrorContains(t, err, "does not exist")
+	})
+
+	t.Run("Escaped", func(t *testing.T) {
+		data, err := util.ExpandConfig([]byte("name: $${NSH_TEST_UNSET}\n"), t.TempDir())
+		require.NoError(t, err)
+		require.Equal(t, "name: ${NSH_TEST_UNSET}\n", string(data))
+	})
+}
+
+func TestUpdateTemplatedConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "noisysockets.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte(templatedConfig), 0o600))
+
+	err := util.MoveKeyToKeyring(slog.Default(), configPath, "test")
+	require.ErrorContains(t, err, "edit it by hand")
+}
@@ -10,11 +10,16 @@
 package validate
 
 import (
+	"encoding/base64"
 	"fmt"
 	stdnet "net"
 	"net/netip"
+	"strconv"
 )
 
+// The size of a WireGuard key in bytes.
+const keySize = 32
+
 // IPs validates a list of IP addresses.
 func IPs(ips []string) error {
 	for _, ip := range ips {
@@ -51,3 +56,32 @@ func CIDR(cidr string) error {
 	}
 	return nil
 }
+
+// Port validates a TCP/UDP port number.
+func Port(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %d: must be between 1 and 65535", port)
+	}
+	return nil
+}
+
+// PortString validates a TCP/UDP port number string.
+func PortString(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return fmt.Errorf("invalid port %q: %w", port, err)
+	}
+	return Port(n)
+}
+
+// Key validates a base64 encoded WireGuard (Curve25519) key.
+func Key(key string) error {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	if len(b) != keySize {
+		return fmt.Errorf("invalid key: expected %d bytes, got %d", keySize, len(b))
+	}
+	return nil
+}
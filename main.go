@@ -13,24 +13,45 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/netip"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/noisysockets/network"
-	"github.com/noisysockets/noisysockets/config"
 	latestconfig "github.com/noisysockets/noisysockets/config/v1alpha2"
+	benchcmd "github.com/noisysockets/nsh/cmd/bench"
+	completioncmd "github.com/noisysockets/nsh/cmd/completion"
 	configcmd "github.com/noisysockets/nsh/cmd/config"
+	daemoncmd "github.com/noisysockets/nsh/cmd/daemon"
+	directorycmd "github.com/noisysockets/nsh/cmd/directory"
 	dnscmd "github.com/noisysockets/nsh/cmd/dns"
+	dockercmd "github.com/noisysockets/nsh/cmd/docker"
+	forwardcmd "github.com/noisysockets/nsh/cmd/forward"
+	nccmd "github.com/noisysockets/nsh/cmd/nc"
 	peercmd "github.com/noisysockets/nsh/cmd/peer"
+	pingcmd "github.com/noisysockets/nsh/cmd/ping"
+	profilecmd "github.com/noisysockets/nsh/cmd/profile"
+	proxycmd "github.com/noisysockets/nsh/cmd/proxy"
+	proxycommandcmd "github.com/noisysockets/nsh/cmd/proxycommand"
 	routecmd "github.com/noisysockets/nsh/cmd/route"
+	servecmd "github.com/noisysockets/nsh/cmd/serve"
+	sidecarcmd "github.com/noisysockets/nsh/cmd/sidecar"
+	statuscmd "github.com/noisysockets/nsh/cmd/status"
 	upcmd "github.com/noisysockets/nsh/cmd/up"
+	updatecmd "github.com/noisysockets/nsh/cmd/update"
 	"github.com/noisysockets/nsh/internal/constants"
+	"github.com/noisysockets/nsh/internal/directory"
+	"github.com/noisysockets/nsh/internal/output"
 	"github.com/noisysockets/nsh/internal/service"
 	"github.com/noisysockets/nsh/internal/util"
+	"github.com/noisysockets/nsh/internal/validate"
 	"github.com/noisysockets/telemetry"
 	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
 
@@ -47,6 +68,32 @@ func main() {
 		os.Exit(1)
 	}
 
+	socketPath, err := xdg.RuntimeFile("nsh/daemon.sock")
+	if err != nil {
+		logger.Error("Error getting daemon socket path", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	socketFlag := &cli.StringFlag{
+		Name:  "socket",
+		Usage: "The control socket of the nsh daemon",
+		Value: socketPath,
+	}
+
+	configFlag := &cli.StringFlag{
+		Name:    "config",
+		Aliases: []string{"c"},
+		Usage:   "Noisy Sockets configuration file (or a https:// or s3:// URL to fetch it from)",
+		Value:   configPath,
+		EnvVars: []string{"NSH_CONFIG"},
+	}
+
+	configPublicKeyFlag := &cli.StringFlag{
+		Name:    "config-public-key",
+		Usage:   "Verify the minisign signature of a remote configuration file with the given public key",
+		EnvVars: []string{"NSH_CONFIG_PUBLIC_KEY"},
+	}
+
 	sharedFlags := []cli.Flag{
 		&cli.GenericFlag{
 			Name:  "log-level",
@@ -54,17 +101,123 @@ func main() {
 			Value: util.FromSlogLevel(slog.LevelInfo),
 		},
 		&cli.StringFlag{
-			Name:    "config",
-			Aliases: []string{"c"},
-			Usage:   "Noisy Sockets configuration file",
-			Value:   configPath,
+			Name:  "log-format",
+			Usage: "Set the log output format (text, json)",
+			Value: util.LogFormatText,
+		},
+		&cli.StringFlag{
+			Name:  "log-file",
+			Usage: "Write logs to the given file instead of stderr",
+		},
+		&cli.Int64Flag{
+			Name:  "log-max-size",
+			Usage: "Rotate the log file once it exceeds this size in megabytes (0 disables)",
+			Value: 100,
+		},
+		&cli.DurationFlag{
+			Name:  "log-max-age",
+			Usage: "Rotate the log file once it is older than this duration (0 disables)",
+		},
+		&cli.IntFlag{
+			Name:  "log-max-backups",
+			Usage: "The number of rotated log files to retain (0 retains all)",
+			Value: 5,
+		},
+		configFlag,
+		configPublicKeyFlag,
+		&cli.DurationFlag{
+			Name:  "endpoint-resolve-interval",
+			Usage: "How often to re-resolve the hostnames of peer endpoints (0 disables)",
+			Value: 5 * time.Minute,
+		},
+	}
+
+	directoryFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:  "directory",
+			Usage: "The URL of a directory server to register with and learn peers from",
+		},
+		&cli.StringFlag{
+			Name:    "directory-token",
+			Usage:   "The token used to authenticate with the directory server",
+			EnvVars: []string{"NSH_DIRECTORY_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:  "directory-endpoint",
+			Usage: "The address (host:port) other peers can reach this peer on",
+		},
+		&cli.DurationFlag{
+			Name:  "directory-interval",
+			Usage: "How often to refresh peers from the directory server",
+			Value: time.Minute,
+		},
+		&cli.StringFlag{
+			Name:  "directory-tls-cert",
+			Usage: "The TLS client certificate file to present to the directory server",
+		},
+		&cli.StringFlag{
+			Name:  "directory-tls-key",
+			Usage: "The TLS client private key file to present to the directory server",
+		},
+	}
+
+	outputFlag := &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Output format (table, json, yaml)",
+		Value:   output.Table,
+	}
+
+	accessFlags := []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "allow-cidr",
+			Usage: "Only allow requests from WireGuard network addresses in the given CIDR/s",
 		},
+		&cli.StringSliceFlag{
+			Name:  "deny-cidr",
+			Usage: "Deny requests from WireGuard network addresses in the given CIDR/s (takes precedence over --allow-cidr)",
+		},
+	}
+
+	// Returns the directory service, if a directory server is configured.
+	directoryServices := func(c *cli.Context) ([]service.Service, error) {
+		if c.String("directory") == "" {
+			return nil, nil
+		}
+
+		s, err := directorycmd.Service(logger, conf, c.String("directory"), c.String("directory-token"),
+			c.String("directory-endpoint"), c.Duration("directory-interval"),
+			c.String("directory-tls-cert"), c.String("directory-tls-key"))
+		if err != nil {
+			return nil, err
+		}
+
+		return []service.Service{s}, nil
 	}
 
 	initLogger := func(c *cli.Context) error {
-		logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		var w io.Writer = os.Stderr
+		if logPath := c.String("log-file"); logPath != "" {
+			rf, err := util.OpenRotatingFile(logPath, util.RotatingFileOptions{
+				MaxSize:    c.Int64("log-max-size") * 1024 * 1024,
+				MaxAge:     c.Duration("log-max-age"),
+				MaxBackups: c.Int("log-max-backups"),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to open log file: %w", err)
+			}
+
+			w = rf
+		}
+
+		h, err := util.NewLogHandler(w, c.String("log-format"), &slog.HandlerOptions{
 			Level: (*slog.Level)(c.Generic("log-level").(*util.LevelFlag)),
-		}))
+		})
+		if err != nil {
+			return err
+		}
+
+		logger = slog.New(h)
 
 		return nil
 	}
@@ -72,23 +225,52 @@ func main() {
 	loadConfig := func(c *cli.Context) error {
 		configPath := c.String("config")
 
-		logger.Debug("Loading config", slog.String("path", configPath))
+		readConfig := func() (*latestconfig.Config, error) {
+			logger.Debug("Loading config", slog.String("path", configPath))
 
-		configFile, err := os.Open(configPath)
-		if err != nil {
-			if os.IsNotExist(err) {
-				return fmt.Errorf("config file %q does not exist, run `nsh config init` to create one", configPath)
+			if util.IsRemoteConfig(configPath) {
+				data, err := util.FetchConfig(c.Context, logger, configPath, c.String("config-public-key"))
+				if err != nil {
+					return nil, err
+				}
+
+				conf, err := util.ParseRemoteConfig(data)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read config: %w", err)
+				}
+
+				return conf, nil
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil, fmt.Errorf("config file %q does not exist, run `nsh config init` to create one", configPath)
+				}
+
+				return nil, fmt.Errorf("failed to open config file: %w", err)
 			}
 
-			return fmt.Errorf("failed to open config file: %w", err)
+			conf, err := util.ParseConfig(data, filepath.Dir(configPath))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read config: %w", err)
+			}
+
+			return conf, nil
 		}
-		defer configFile.Close()
 
-		conf, err = config.FromYAML(configFile)
+		var err error
+		conf, err = readConfig()
 		if err != nil {
-			return fmt.Errorf("failed to read config: %w", err)
+			return err
 		}
 
+		// Long running commands reload the config on SIGHUP.
+		c.Context = upcmd.WithConfigLoader(c.Context, readConfig)
+
+		// And keep track of peers with dynamic endpoint addresses.
+		c.Context = upcmd.WithResolveInterval(c.Context, c.Duration("endpoint-resolve-interval"))
+
 		return nil
 	}
 
@@ -96,6 +278,13 @@ func main() {
 	var telemetryReporter *telemetry.Reporter
 
 	initTelemetry := func(c *cli.Context) error {
+		// The reporter prints failures to stdout, which would corrupt machine
+		// readable output.
+		if slices.Contains(c.Command.Flags, cli.Flag(outputFlag)) &&
+			c.IsSet(outputFlag.Name) && !output.IsHuman(c.String(outputFlag.Name)) {
+			return nil
+		}
+
 		telemetryReporter = telemetry.NewReporter(c.Context, logger, telemetry.Configuration{
 			BaseURL:   constants.TelemetryURL,
 			AuthToken: constants.TelemetryToken,
@@ -145,11 +334,148 @@ func main() {
 		return nil
 	}
 
+	// Shell completion runs without any of the Before funcs, so the config path
+	// for the selected profile has to be worked out by hand.
+	completionConfigPath := func(c *cli.Context) string {
+		if c.IsSet("config") {
+			return c.String("config")
+		}
+
+		configPath, err := profilecmd.ConfigPath(c.String("profile"))
+		if err != nil {
+			return ""
+		}
+
+		return configPath
+	}
+
 	app := &cli.App{
 		Name:    "nsh",
 		Usage:   "The Noisy Sockets CLI",
 		Version: constants.Version,
+		// Used by the shell completion scripts.
+		EnableBashCompletion: true,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "profile",
+				Aliases: []string{"p"},
+				Usage:   "The configuration profile to use",
+				EnvVars: []string{"NSH_PROFILE"},
+				Value:   profilecmd.DefaultProfile,
+			},
+		},
+		// Select the configuration file and daemon socket for the profile.
+		Before: func(c *cli.Context) error {
+			configPath, err := profilecmd.ConfigPath(c.String("profile"))
+			if err != nil {
+				return err
+			}
+
+			socketPath, err := profilecmd.SocketPath(c.String("profile"))
+			if err != nil {
+				return err
+			}
+
+			configFlag.Value = configPath
+			socketFlag.Value = socketPath
+
+			return nil
+		},
 		Commands: []*cli.Command{
+			{
+				Name:  "bench",
+				Usage: "Measure the performance of the WireGuard network",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "serve",
+						Usage: "Start a benchmark server",
+						Flags: append([]cli.Flag{
+							&cli.IntFlag{
+								Name:    "port",
+								Aliases: []string{"p"},
+								Usage:   "The port to listen on",
+								Value:   service.DefaultBenchPort,
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if err := validate.Port(c.Int("port")); err != nil {
+								return err
+							}
+
+							return benchcmd.Serve(c.Context, logger, conf, c.Int("port"))
+						},
+					},
+					{
+						Name:         "run",
+						Usage:        "Measure the latency and throughput to a benchmark server",
+						Args:         true,
+						ArgsUsage:    "host",
+						BashComplete: completioncmd.PeerNames(completionConfigPath),
+						Flags: append([]cli.Flag{
+							&cli.IntFlag{
+								Name:    "port",
+								Aliases: []string{"p"},
+								Usage:   "The port of the benchmark server",
+								Value:   service.DefaultBenchPort,
+							},
+							&cli.DurationFlag{
+								Name:    "duration",
+								Aliases: []string{"t"},
+								Usage:   "How long to send data for",
+								Value:   10 * time.Second,
+							},
+							outputFlag,
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected host as argument")
+							}
+
+							if err := validate.Port(c.Int("port")); err != nil {
+								return err
+							}
+
+							return benchcmd.Run(c.Context, logger, conf, c.Args().First(),
+								c.Int("port"), c.Duration("duration"), c.String("output"))
+						},
+					},
+				},
+			},
+			{
+				Name:      "completion",
+				Usage:     "Generate a shell completion script",
+				Args:      true,
+				ArgsUsage: strings.Join(completioncmd.Shells, " | "),
+				BashComplete: func(c *cli.Context) {
+					for _, shell := range completioncmd.Shells {
+						fmt.Fprintln(c.App.Writer, shell)
+					}
+				},
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						_ = cli.ShowSubcommandHelp(c)
+						return errors.New("expected shell as argument")
+					}
+
+					return completioncmd.Script(os.Stdout, c.Args().First())
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:   "metadata",
+						Usage:  "Print the available commands and configured peers as JSON",
+						Hidden: true,
+						Flags:  []cli.Flag{configFlag},
+						Action: func(c *cli.Context) error {
+							return completioncmd.WriteMetadata(os.Stdout, c.App, c.String("config"))
+						},
+					},
+				},
+			},
 			{
 				Name:  "config",
 				Usage: "Manage configuration",
@@ -177,10 +503,26 @@ func main() {
 								Aliases: []string{"d"},
 								Usage:   "The network domain",
 							},
+							&cli.BoolFlag{
+								Name:    "interactive",
+								Aliases: []string{"i"},
+								Usage:   "Prompt for the configuration and initial peers",
+							},
 						}, sharedFlags...),
 						Before: beforeAll(initLogger, initTelemetry),
 						After:  shutdownTelemetry,
 						Action: func(c *cli.Context) error {
+							if c.Bool("interactive") {
+								return configcmd.InitInteractive(logger,
+									c.String("config"),
+									os.Stdin,
+									os.Stdout,
+									c.String("name"),
+									c.Int("listen-port"),
+									c.StringSlice("ip"),
+									c.String("domain"))
+							}
+
 							return configcmd.Init(logger,
 								c.String("config"),
 								c.String("name"),
@@ -190,8 +532,10 @@ func main() {
 						},
 					},
 					{
-						Name:  "import",
-						Usage: "Import existing WireGuard configuration",
+						Name:      "import",
+						Usage:     "Import existing WireGuard configuration",
+						Args:      true,
+						ArgsUsage: "[file]",
 						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:    "input",
@@ -199,14 +543,90 @@ func main() {
 								Usage:   "The path to read the WireGuard formatted configuration",
 								Value:   "-",
 							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "The format of the WireGuard configuration (wg-quick, wg)",
+								Value:   configcmd.FormatWGQuick,
+							},
 						}, sharedFlags...),
 						Before: beforeAll(initLogger, initTelemetry),
 						After:  shutdownTelemetry,
 						Action: func(c *cli.Context) error {
+							if c.Args().Len() > 1 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected at most one file as argument")
+							}
+
+							input := c.String("input")
+							if c.Args().Present() {
+								input = c.Args().First()
+							}
+
 							return configcmd.Import(
 								logger,
 								c.String("config"),
-								c.String("input"))
+								input,
+								c.String("format"))
+						},
+					},
+					{
+						Name:   "encrypt",
+						Usage:  "Encrypt the configuration file with a passphrase",
+						Flags:  sharedFlags,
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return util.EncryptConfig(logger, c.String("config"))
+						},
+					},
+					{
+						Name:   "decrypt",
+						Usage:  "Decrypt an encrypted configuration file",
+						Flags:  sharedFlags,
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return util.DecryptConfig(logger, c.String("config"))
+						},
+					},
+					{
+						Name:  "keyring",
+						Usage: "Manage storage of the private key in the OS keyring",
+						Subcommands: []*cli.Command{
+							{
+								Name:  "store",
+								Usage: "Move the private key from the configuration file into the OS keyring",
+								Flags: append([]cli.Flag{
+									&cli.StringFlag{
+										Name:  "id",
+										Usage: "The id of the keyring entry (defaults to the peer name)",
+									},
+								}, sharedFlags...),
+								Before: beforeAll(initLogger, initTelemetry, loadConfig),
+								After:  shutdownTelemetry,
+								Action: func(c *cli.Context) error {
+									id := c.String("id")
+									if id == "" {
+										id = conf.Name
+									}
+									if id == "" {
+										return errors.New("the configuration has no name, please provide an id")
+									}
+
+									return util.MoveKeyToKeyring(logger, c.String("config"), id)
+								},
+							},
+							{
+								Name:   "restore",
+								Usage:  "Move the private key from the OS keyring back into the configuration file",
+								Flags:  sharedFlags,
+								Before: beforeAll(initLogger, initTelemetry),
+								After:  shutdownTelemetry,
+								Action: func(c *cli.Context) error {
+									return util.MoveKeyFromKeyring(logger, c.String("config"))
+								},
+							},
 						},
 					},
 					{
@@ -219,19 +639,58 @@ func main() {
 								Usage:   "The path to write the WireGuard formatted configuration",
 								Value:   "-",
 							},
+							&cli.StringFlag{
+								Name:    "format",
+								Aliases: []string{"f"},
+								Usage:   "The format of the WireGuard configuration (wg-quick, wg)",
+								Value:   configcmd.FormatWGQuick,
+							},
 							&cli.BoolFlag{
 								Name:  "stripped",
-								Usage: "Remove wg-quick specific fields",
+								Usage: "Remove wg-quick specific fields (same as --format=wg)",
 								Value: false,
 							},
+							&cli.BoolFlag{
+								Name:  "qr",
+								Usage: "Render the configuration as a QR code (for mobile WireGuard clients)",
+							},
 						}, sharedFlags...),
-						Before: beforeAll(initLogger, initTelemetry, loadConfig),
-						After:  shutdownTelemetry,
+						Before: beforeAll(initLogger, func(c *cli.Context) error {
+							// The configuration is written to stdout by default.
+							if c.String("output") == "-" {
+								return nil
+							}
+
+							return initTelemetry(c)
+						}, loadConfig),
+						After: shutdownTelemetry,
 						Action: func(c *cli.Context) error {
+							format := c.String("format")
+							if c.Bool("stripped") {
+								format = configcmd.FormatWireGuard
+							}
+
 							return configcmd.Export(
+								logger,
 								conf,
 								c.String("output"),
-								c.Bool("stripped"))
+								format,
+								c.Bool("qr"))
+						},
+					},
+					{
+						Name:  "rotate-key",
+						Usage: "Replace the private key with a newly generated one",
+						Flags: append([]cli.Flag{
+							&cli.BoolFlag{
+								Name:  "qr",
+								Usage: "Also render the new public key as a QR code",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return configcmd.RotateKey(logger, c.String("config"), os.Stdout, c.Bool("qr"))
 						},
 					},
 					{
@@ -240,8 +699,8 @@ func main() {
 						Flags:     sharedFlags,
 						Args:      true,
 						ArgsUsage: "query",
-						Before:    beforeAll(initLogger, initTelemetry, loadConfig),
-						After:     shutdownTelemetry,
+						// No telemetry, the reporter would corrupt the output.
+						Before: beforeAll(initLogger, loadConfig),
 						Action: func(c *cli.Context) error {
 							if c.Args().Len() != 1 {
 								_ = cli.ShowSubcommandHelp(c)
@@ -251,6 +710,32 @@ func main() {
 							return configcmd.Show(c.Context, conf, c.Args().First())
 						},
 					},
+					{
+						Name:  "validate",
+						Usage: "Check the configuration file for errors and potential problems",
+						Flags: append([]cli.Flag{
+							&cli.BoolFlag{
+								Name:  "strict",
+								Usage: "Treat warnings as errors",
+							},
+							outputFlag,
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return configcmd.Validate(c.Context, os.Stdout, c.String("config"), c.Bool("strict"), c.String("output"))
+						},
+					},
+					{
+						Name:  "schema",
+						Usage: "Print the JSON Schema for the configuration format",
+						Flags: sharedFlags,
+						// No telemetry, the reporter would corrupt the output.
+						Before: initLogger,
+						Action: func(c *cli.Context) error {
+							return configcmd.PrintSchema()
+						},
+					},
 				},
 			},
 			{
@@ -297,13 +782,14 @@ func main() {
 						},
 					},
 					{
-						Name:      "remove",
-						Usage:     "Remove a peer",
-						Flags:     sharedFlags,
-						Args:      true,
-						ArgsUsage: "name | public-key",
-						Before:    beforeAll(initLogger, initTelemetry, loadConfig),
-						After:     shutdownTelemetry,
+						Name:         "remove",
+						Usage:        "Remove a peer",
+						Flags:        sharedFlags,
+						Args:         true,
+						ArgsUsage:    "name | public-key",
+						BashComplete: completioncmd.PeerNames(completionConfigPath),
+						Before:       beforeAll(initLogger, initTelemetry, loadConfig),
+						After:        shutdownTelemetry,
 						Action: func(c *cli.Context) error {
 							if c.Args().Len() != 1 {
 								_ = cli.ShowSubcommandHelp(c)
@@ -317,6 +803,18 @@ func main() {
 							)
 						},
 					},
+					{
+						Name:  "list",
+						Usage: "List peers",
+						Flags: append([]cli.Flag{
+							outputFlag,
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return peercmd.List(conf, c.String("output"))
+						},
+					},
 				},
 			},
 			{
@@ -351,6 +849,23 @@ func main() {
 							)
 						},
 					},
+					{
+						Name:      "advertise",
+						Usage:     "Act as a gateway to local subnets for other peers",
+						Flags:     sharedFlags,
+						Args:      true,
+						ArgsUsage: "destination...",
+						Before:    beforeAll(initLogger, initTelemetry, loadConfig),
+						After:     shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() == 0 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected at least one destination CIDR as argument")
+							}
+
+							return routecmd.Advertise(c.Context, logger, conf, c.Args().Slice())
+						},
+					},
 					{
 						Name:      "remove",
 						Usage:     "Remove a route",
@@ -375,24 +890,122 @@ func main() {
 				},
 			},
 			{
-				Name:  "dns",
-				Usage: "Manage DNS configuration",
+				Name:   "daemon",
+				Usage:  "Keep the WireGuard network open for use by other commands",
+				Flags:  append(append([]cli.Flag{socketFlag}, directoryFlags...), sharedFlags...),
+				Before: beforeAll(initLogger, initTelemetry, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					services, err := directoryServices(c)
+					if err != nil {
+						return err
+					}
+
+					return daemoncmd.Daemon(c.Context, logger, conf, c.String("socket"), services)
+				},
+			},
+			{
+				Name:  "directory",
+				Usage: "Share peers between members of the WireGuard network",
 				Subcommands: []*cli.Command{
 					{
-						Name:  "server",
-						Usage: "Manage DNS servers",
-						Subcommands: []*cli.Command{
-							{
-								Name:      "add",
-								Usage:     "Add a DNS server",
-								Args:      true,
-								ArgsUsage: "address",
-								Flags:     sharedFlags,
-								Before:    beforeAll(initLogger, initTelemetry, loadConfig),
-								After:     shutdownTelemetry,
-								Action: func(c *cli.Context) error {
-									if c.Args().Len() != 1 {
-										_ = cli.ShowSubcommandHelp(c)
+						Name:  "serve",
+						Usage: "Run a directory server that peers can register with",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The host network address to listen on",
+								Value: ":8080",
+							},
+							&cli.StringFlag{
+								Name:    "token",
+								Usage:   "The token clients must present to register and list peers",
+								EnvVars: []string{"NSH_DIRECTORY_TOKEN"},
+							},
+							&cli.DurationFlag{
+								Name:  "ttl",
+								Usage: "How long a registration lasts without being refreshed (0 for forever)",
+								Value: 10 * time.Minute,
+							},
+							&cli.StringFlag{
+								Name:  "state",
+								Usage: "A file to persist registrations in across restarts",
+							},
+							&cli.StringFlag{
+								Name:  "tls-cert",
+								Usage: "The TLS certificate file to serve HTTPS with",
+							},
+							&cli.StringFlag{
+								Name:  "tls-key",
+								Usage: "The TLS private key file to serve HTTPS with",
+							},
+							&cli.StringFlag{
+								Name:  "mtls-ca",
+								Usage: "Require clients to present a TLS certificate signed by a CA in the given file",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return directorycmd.Serve(c.Context, logger, &directorycmd.ServeOptions{
+								ListenAddr:   c.String("listen"),
+								TLSCertFile:  c.String("tls-cert"),
+								TLSKeyFile:   c.String("tls-key"),
+								ClientCAFile: c.String("mtls-ca"),
+								ServerConfig: directory.ServerConfig{
+									Token:     c.String("token"),
+									TTL:       c.Duration("ttl"),
+									StatePath: c.String("state"),
+								},
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:  "dns",
+				Usage: "Manage DNS configuration",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "serve",
+						Usage: "Start a DNS server that resolves peer names",
+						Flags: append([]cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "listen",
+								Usage: "The host address/es to listen on for DNS queries",
+								Value: cli.NewStringSlice("127.0.0.1:8053"),
+							},
+							&cli.BoolFlag{
+								Name:  "wireguard",
+								Usage: "Also listen on port 53 of the WireGuard network",
+							},
+							&cli.StringSliceFlag{
+								Name:  "split-domain",
+								Usage: "Resolve names in the given domain/s using the DNS servers on the WireGuard network",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return dnscmd.Serve(c.Context, logger, conf, c.StringSlice("listen"),
+								c.Bool("wireguard"), c.StringSlice("split-domain"))
+						},
+					},
+					{
+						Name:  "server",
+						Usage: "Manage DNS servers",
+						Subcommands: []*cli.Command{
+							{
+								Name:      "add",
+								Usage:     "Add a DNS server",
+								Args:      true,
+								ArgsUsage: "address",
+								Flags:     sharedFlags,
+								Before:    beforeAll(initLogger, initTelemetry, loadConfig),
+								After:     shutdownTelemetry,
+								Action: func(c *cli.Context) error {
+									if c.Args().Len() != 1 {
+										_ = cli.ShowSubcommandHelp(c)
 										return errors.New("expected DNS server address as argument")
 									}
 
@@ -407,6 +1020,472 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "docker",
+				Usage: "Use Docker daemons over the WireGuard network",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "expose",
+						Usage: "Expose this machine's Docker daemon to the WireGuard network",
+						Flags: append([]cli.Flag{
+							socketFlag,
+							&cli.StringFlag{
+								Name:  "docker-socket",
+								Usage: "The path of the Docker daemon socket",
+								Value: "/var/run/docker.sock",
+							},
+							&cli.IntFlag{
+								Name:    "port",
+								Aliases: []string{"p"},
+								Usage:   "The port to expose the Docker API on",
+								Value:   dockercmd.DefaultPort,
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if err := validate.Port(c.Int("port")); err != nil {
+								return err
+							}
+
+							return dockercmd.Expose(c.Context, logger, conf, c.String("socket"), c.String("docker-socket"), c.Int("port"))
+						},
+					},
+					{
+						Name:         "connect",
+						Usage:        "Use the Docker daemon exposed by a peer, optionally running a command with DOCKER_HOST set",
+						Args:         true,
+						ArgsUsage:    "peer [-- command [args...]]",
+						BashComplete: completioncmd.PeerNames(completionConfigPath),
+						Flags: append([]cli.Flag{
+							socketFlag,
+							&cli.IntFlag{
+								Name:    "port",
+								Aliases: []string{"p"},
+								Usage:   "The port the peer exposes the Docker API on",
+								Value:   dockercmd.DefaultPort,
+							},
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The path of the local socket to create, if not set a temporary socket is used",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() == 0 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected peer as argument")
+							}
+
+							if err := validate.Port(c.Int("port")); err != nil {
+								return err
+							}
+
+							// Flag parsing stops at the peer, so the separator is passed through.
+							args := c.Args().Tail()
+							if len(args) > 0 && args[0] == "--" {
+								args = args[1:]
+							}
+
+							return dockercmd.Connect(c.Context, logger, conf, c.String("socket"),
+								c.Args().First(), c.Int("port"), c.String("listen"), args)
+						},
+					},
+				},
+			},
+			{
+				Name:  "forward",
+				Usage: "Forward ports between this machine and the WireGuard network",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "local",
+						Usage:     "Forward local ports to the WireGuard network",
+						Flags:     append([]cli.Flag{socketFlag}, sharedFlags...),
+						Args:      true,
+						ArgsUsage: "[bind_address:]port:host:hostport[/protocol]...",
+						Before:    beforeAll(initLogger, initTelemetry, loadConfig),
+						After:     shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() == 0 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected at least one port mapping as argument")
+							}
+
+							return forwardcmd.Forward(c.Context, logger, conf, c.String("socket"), service.ForwardLocal, c.Args().Slice())
+						},
+					},
+					{
+						Name:      "remote",
+						Usage:     "Forward ports on the WireGuard network to this machine",
+						Flags:     append([]cli.Flag{socketFlag}, sharedFlags...),
+						Args:      true,
+						ArgsUsage: "[bind_address:]port:host:hostport[/protocol]...",
+						Before:    beforeAll(initLogger, initTelemetry, loadConfig),
+						After:     shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() == 0 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected at least one port mapping as argument")
+							}
+
+							return forwardcmd.Forward(c.Context, logger, conf, c.String("socket"), service.ForwardRemote, c.Args().Slice())
+						},
+					},
+				},
+			},
+			{
+				Name:         "nc",
+				Aliases:      []string{"netcat"},
+				Usage:        "Read and write data over TCP or UDP connections on the WireGuard network",
+				Args:         true,
+				ArgsUsage:    "host port | -l [address:]port",
+				BashComplete: completioncmd.PeerNames(completionConfigPath),
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:    "listen",
+						Aliases: []string{"l"},
+						Usage:   "Listen for a connection instead of connecting",
+					},
+					&cli.BoolFlag{
+						Name:    "udp",
+						Aliases: []string{"u"},
+						Usage:   "Use UDP instead of TCP",
+					},
+					&cli.DurationFlag{
+						Name:    "timeout",
+						Aliases: []string{"w"},
+						Usage:   "How long to wait for the connection to be established (0 for no timeout)",
+						Value:   30 * time.Second,
+					},
+					socketFlag,
+				}, sharedFlags...),
+				// No telemetry, as the reporter can print errors to stdout, which
+				// would corrupt the data stream.
+				Before: beforeAll(initLogger, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					opts := &nccmd.Options{
+						UDP:        c.Bool("udp"),
+						Timeout:    c.Duration("timeout"),
+						SocketPath: c.String("socket"),
+					}
+
+					if c.Bool("listen") {
+						if c.Args().Len() != 1 {
+							_ = cli.ShowSubcommandHelp(c)
+							return errors.New("expected listen address as argument")
+						}
+
+						return nccmd.Listen(c.Context, logger, conf, c.Args().First(), opts)
+					}
+
+					if c.Args().Len() != 2 {
+						_ = cli.ShowSubcommandHelp(c)
+						return errors.New("expected host and port as arguments")
+					}
+
+					return nccmd.Dial(c.Context, logger, conf, c.Args().Get(0), c.Args().Get(1), opts)
+				},
+			},
+			{
+				Name:         "ping",
+				Usage:        "Ping a host on the WireGuard network",
+				Args:         true,
+				ArgsUsage:    "host",
+				BashComplete: completioncmd.PeerNames(completionConfigPath),
+				Flags: append([]cli.Flag{
+					&cli.IntFlag{
+						Name:    "count",
+						Aliases: []string{"n"},
+						Usage:   "Number of pings to send (0 to ping until interrupted)",
+						Value:   4,
+					},
+					&cli.DurationFlag{
+						Name:    "interval",
+						Aliases: []string{"i"},
+						Usage:   "Interval between pings",
+						Value:   time.Second,
+					},
+					&cli.DurationFlag{
+						Name:    "timeout",
+						Aliases: []string{"W"},
+						Usage:   "How long to wait for each reply",
+						Value:   10 * time.Second,
+					},
+				}, sharedFlags...),
+				Before: beforeAll(initLogger, initTelemetry, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					if c.Args().Len() != 1 {
+						_ = cli.ShowSubcommandHelp(c)
+						return errors.New("expected host as argument")
+					}
+
+					if c.Int("count") < 0 {
+						return errors.New("count must not be negative")
+					}
+
+					return pingcmd.Ping(c.Context, logger, conf, c.Args().First(),
+						c.Int("count"), c.Duration("interval"), c.Duration("timeout"))
+				},
+			},
+			{
+				Name:  "profile",
+				Usage: "Manage configuration profiles",
+				Subcommands: []*cli.Command{
+					{
+						Name:   "list",
+						Usage:  "List configuration profiles",
+						Flags:  append([]cli.Flag{outputFlag}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return profilecmd.List(os.Stdout, c.String("profile"), c.String("output"))
+						},
+					},
+					{
+						Name:      "create",
+						Usage:     "Create a new configuration profile",
+						Args:      true,
+						ArgsUsage: "name",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:    "name",
+								Aliases: []string{"n"},
+								Usage:   "The name of the peer",
+							},
+							&cli.IntFlag{
+								Name:    "listen-port",
+								Aliases: []string{"l"},
+								Usage:   "The port to listen on",
+							},
+							&cli.StringSliceFlag{
+								Name:  "ip",
+								Usage: "The IP address/s to assign to the peer, if not set a random IPv6 address will be assigned",
+							},
+							&cli.StringFlag{
+								Name:    "domain",
+								Aliases: []string{"d"},
+								Usage:   "The network domain",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected profile name as argument")
+							}
+
+							return profilecmd.Create(logger,
+								c.Args().First(),
+								c.String("name"),
+								c.Int("listen-port"),
+								c.StringSlice("ip"),
+								c.String("domain"))
+						},
+					},
+					{
+						Name:      "delete",
+						Usage:     "Delete a configuration profile",
+						Args:      true,
+						ArgsUsage: "name",
+						Flags:     sharedFlags,
+						Before:    beforeAll(initLogger, initTelemetry),
+						After:     shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected profile name as argument")
+							}
+
+							return profilecmd.Delete(logger, c.Args().First())
+						},
+					},
+				},
+			},
+			{
+				Name:  "proxy",
+				Usage: "Proxy connections from this machine to the WireGuard network",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "socks5",
+						Usage: "Start a SOCKS5 proxy server",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The address to listen on for SOCKS5 connections",
+								Value: "127.0.0.1:1080",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return proxycmd.SOCKS5(c.Context, logger, conf, c.String("listen"))
+						},
+					},
+					{
+						Name:  "http",
+						Usage: "Start a HTTP proxy server",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The address to listen on for HTTP proxy connections",
+								Value: "127.0.0.1:8080",
+							},
+						}, sharedFlags...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							return proxycmd.HTTP(c.Context, logger, conf, c.String("listen"))
+						},
+					},
+				},
+			},
+			{
+				Name:         "proxycommand",
+				Usage:        "Connect stdin and stdout to a peer, for use as an OpenSSH ProxyCommand",
+				Args:         true,
+				ArgsUsage:    "host port",
+				BashComplete: completioncmd.PeerNames(completionConfigPath),
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "ssh-config",
+						Usage: "Print an OpenSSH client configuration for connecting to each peer",
+					},
+					socketFlag,
+				}, sharedFlags...),
+				// No telemetry, as the reporter can print errors to stdout, which
+				// would corrupt the SSH session.
+				Before: beforeAll(initLogger, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					if c.Bool("ssh-config") {
+						return proxycommandcmd.SSHConfig(os.Stdout, conf, c.String("profile"))
+					}
+
+					if c.Args().Len() != 2 {
+						_ = cli.ShowSubcommandHelp(c)
+						return errors.New("expected host and port as arguments")
+					}
+
+					return proxycommandcmd.ProxyCommand(c.Context, logger, conf, c.String("socket"), c.Args().Get(0), c.Args().Get(1))
+				},
+			},
+			{
+				Name:  "serve",
+				Usage: "Share services on this machine with the WireGuard network",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "http",
+						Usage: "Reverse proxy HTTP requests from the WireGuard network to local servers",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The WireGuard network address to listen on",
+								Value: ":80",
+							},
+							&cli.StringSliceFlag{
+								Name:     "upstream",
+								Usage:    "The upstream server URL, optionally prefixed with a path (eg. /api=http://127.0.0.1:8080)",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "path",
+								Usage: "The path prefix for upstreams without an explicit path",
+								Value: "/",
+							},
+						}, append(accessFlags, sharedFlags...)...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							acl, err := service.ParseAccessList(c.StringSlice("allow-cidr"), c.StringSlice("deny-cidr"))
+							if err != nil {
+								return err
+							}
+
+							return servecmd.HTTP(c.Context, logger, conf, c.String("listen"), c.StringSlice("upstream"), c.String("path"), acl)
+						},
+					},
+					{
+						Name:      "files",
+						Usage:     "Serve the contents of a directory to the WireGuard network",
+						Args:      true,
+						ArgsUsage: "dir",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name:  "listen",
+								Usage: "The WireGuard network address to listen on",
+								Value: ":80",
+							},
+							&cli.BoolFlag{
+								Name:  "upload",
+								Usage: "Allow peers to upload files (using PUT requests)",
+							},
+						}, append(accessFlags, sharedFlags...)...),
+						Before: beforeAll(initLogger, initTelemetry, loadConfig),
+						After:  shutdownTelemetry,
+						Action: func(c *cli.Context) error {
+							if c.Args().Len() != 1 {
+								_ = cli.ShowSubcommandHelp(c)
+								return errors.New("expected directory as argument")
+							}
+
+							acl, err := service.ParseAccessList(c.StringSlice("allow-cidr"), c.StringSlice("deny-cidr"))
+							if err != nil {
+								return err
+							}
+
+							return servecmd.Files(c.Context, logger, conf, c.String("listen"), c.Args().First(), c.Bool("upload"), acl)
+						},
+					},
+				},
+			},
+			{
+				Name:  "sidecar",
+				Usage: "Forward ports between a pod (or container) and the WireGuard network",
+				Flags: append([]cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "inbound",
+						Usage:   "Forward a port on the WireGuard network to this machine (port[/protocol] or [bind_address:]port:host:hostport[/protocol])",
+						EnvVars: []string{"NSH_SIDECAR_INBOUND"},
+					},
+					&cli.StringSliceFlag{
+						Name:    "outbound",
+						Usage:   "Forward a local port to the WireGuard network (host:port[/protocol] or [bind_address:]port:host:hostport[/protocol])",
+						EnvVars: []string{"NSH_SIDECAR_OUTBOUND"},
+					},
+				}, append(directoryFlags, sharedFlags...)...),
+				Before: beforeAll(initLogger, initTelemetry, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					services, err := directoryServices(c)
+					if err != nil {
+						return err
+					}
+
+					return sidecarcmd.Sidecar(c.Context, logger, conf,
+						c.StringSlice("inbound"), c.StringSlice("outbound"), services)
+				},
+			},
+			{
+				Name:  "status",
+				Usage: "Show the status of each peer",
+				Flags: append([]cli.Flag{
+					outputFlag,
+					&cli.DurationFlag{
+						Name:  "watch",
+						Usage: "Refresh the status at the given interval (eg. 5s)",
+					},
+					socketFlag,
+				}, sharedFlags...),
+				Before: beforeAll(initLogger, initTelemetry, loadConfig),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					return statuscmd.Status(c.Context, logger, conf, c.String("socket"), c.String("output"), c.Duration("watch"))
+				},
+			},
 			{
 				Name:  "up",
 				Usage: "Start Noisy Sockets",
@@ -429,7 +1508,16 @@ func main() {
 						Usage: "The DNS64/NAT64 prefix",
 						Value: "64:ff9b::/96",
 					},
-				}, sharedFlags...),
+					&cli.IntFlag{
+						Name:    "listen-port",
+						Aliases: []string{"l"},
+						Usage:   "Override the WireGuard UDP port to listen on",
+					},
+					&cli.StringSliceFlag{
+						Name:  "dns-server",
+						Usage: "Override the DNS server/s used within the WireGuard network (host or host:port)",
+					},
+				}, append(directoryFlags, sharedFlags...)...),
 				Before: beforeAll(initLogger, initTelemetry, loadConfig),
 				After:  shutdownTelemetry,
 				Action: func(c *cli.Context) error {
@@ -440,15 +1528,64 @@ func main() {
 						return fmt.Errorf("failed to parse NAT64 prefix: %w", err)
 					}
 
+					var overrides []func(conf *latestconfig.Config)
+
+					if c.IsSet("listen-port") {
+						listenPort := c.Int("listen-port")
+						if err := validate.Port(listenPort); err != nil {
+							return fmt.Errorf("invalid listen port: %w", err)
+						}
+
+						overrides = append(overrides, func(conf *latestconfig.Config) {
+							conf.ListenPort = uint16(listenPort)
+						})
+					}
+
+					if c.IsSet("dns-server") {
+						servers, err := util.ResolveDNSServers(c.Context, c.StringSlice("dns-server"))
+						if err != nil {
+							return fmt.Errorf("invalid DNS server: %w", err)
+						}
+
+						overrides = append(overrides, func(conf *latestconfig.Config) {
+							if conf.DNS == nil {
+								conf.DNS = &latestconfig.DNSConfig{}
+							}
+
+							conf.DNS.Servers = servers
+						})
+					}
+
+					override := func(conf *latestconfig.Config) {
+						for _, o := range overrides {
+							o(conf)
+						}
+					}
+
+					override(conf)
+
+					// Otherwise every reload would look like a change to the overridden fields.
+					c.Context = upcmd.WithConfigOverride(c.Context, override)
+
 					var services []service.Service
 
 					if c.Bool("enable-dns") {
-						services = append(services, service.DNS(logger, enableNAT64, nat64Prefix))
+						services = append(services, service.DNS(logger, &service.DNSServiceConfig{
+							EnableNAT64: enableNAT64,
+							NAT64Prefix: nat64Prefix,
+							Hosts:       util.Hosts(conf),
+						}))
 					}
 
 					if c.Bool("enable-router") {
-						services = append(services, service.Router(logger, network.Host(), enableNAT64, nat64Prefix))
+						services = append(services, service.Router(logger, network.Host(), nil, enableNAT64, nat64Prefix))
+					}
+
+					dirServices, err := directoryServices(c)
+					if err != nil {
+						return err
 					}
+					services = append(services, dirServices...)
 
 					// If all services are disabled, then throw an error.
 					if len(services) == 0 {
@@ -459,6 +1596,40 @@ func main() {
 					return upcmd.Up(c.Context, logger, conf, services)
 				},
 			},
+			{
+				Name:  "update",
+				Usage: "Update nsh to the latest release",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "check-only",
+						Usage: "Only check whether an update is available",
+					},
+					&cli.StringFlag{
+						Name:  "channel",
+						Usage: fmt.Sprintf("The release channel to update from (%s or %s)", updatecmd.ChannelStable, updatecmd.ChannelPrerelease),
+						Value: updatecmd.ChannelStable,
+					},
+					&cli.StringFlag{
+						Name:    "public-key",
+						Usage:   "Minisign public key to verify the release signature with (overrides the built-in key)",
+						EnvVars: []string{"NSH_UPDATE_PUBLIC_KEY"},
+					},
+					&cli.BoolFlag{
+						Name:  "insecure",
+						Usage: "Allow updating without a public key to verify the release signature (only checksums are verified)",
+					},
+				}, sharedFlags...),
+				Before: beforeAll(initLogger, initTelemetry),
+				After:  shutdownTelemetry,
+				Action: func(c *cli.Context) error {
+					return updatecmd.Update(c.Context, logger, os.Stdout, &updatecmd.Options{
+						Channel:   c.String("channel"),
+						CheckOnly: c.Bool("check-only"),
+						PublicKey: c.String("public-key"),
+						Insecure:  c.Bool("insecure"),
+					})
+				},
+			},
 		},
 	}
 